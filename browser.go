@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+type item struct {
+	// directory holding the entry
+	Dir   string
+	Name  string
+	IsDir bool
+	// target of a symbolic link, empty for other entries
+	Link string
+	// the link points to nothing
+	Broken  bool
+	Size    int64
+	ModTime time.Time
+	// read from the PDF in the background, see loadFileMetaCmd
+	Title string
+	Pages int
+}
+
+func (i item) FilterValue() string { return i.Name + " " + i.Title }
+
+func (i item) path() string { return filepath.Join(i.Dir, i.Name) }
+
+func (i item) isParent() bool { return i.Name == ".." }
+
+type itemDelegate struct{}
+
+func (d itemDelegate) Height() int                             { return 1 }
+func (d itemDelegate) Spacing() int                            { return 0 }
+func (d itemDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	i, ok := listItem.(item)
+	if !ok {
+		return
+	}
+
+	str := i.Name
+	details := ""
+	if i.IsDir {
+		str += "/"
+	} else if !i.Broken {
+		details = i.details()
+	}
+	if i.Link != "" {
+		str += " → " + i.Link
+	}
+	if i.Broken {
+		str += " (broken link)"
+	}
+
+	// room left for the name once the padding, the arrow and the details
+	// are drawn
+	nameWidth := m.Width() - 6 - runewidth.StringWidth(details)
+	if nameWidth < 10 {
+		details = ""
+		nameWidth = m.Width() - 6
+	}
+	str = runewidth.Truncate(str, nameWidth, "…")
+	if details != "" {
+		str = runewidth.FillRight(str, nameWidth) + details
+	}
+
+	fn := itemStyle.Render
+	if index == m.Index() {
+		fn = func(s ...string) string {
+			return selectedItemStyle.Render("→ " + strings.Join(s, " "))
+		}
+	}
+
+	fmt.Fprint(w, fn(str))
+}
+
+// details returns the page count, size, modification date and reading
+// progress columns of a PDF.
+func (i item) details() string {
+	pages := ""
+	if i.Pages > 0 {
+		pages = fmt.Sprintf("%d p", i.Pages)
+	}
+	progress := ""
+	if s, ok := history.get(i.path()); ok {
+		progress = s.progress()
+	}
+	return fmt.Sprintf("  %7s  %8s  %10s  %4s", pages, humanSize(i.Size), i.ModTime.Format("2006-01-02"), progress)
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+type sortMode int
+
+const (
+	sortByName sortMode = iota
+	sortByDate
+	sortBySize
+	sortByLastRead
+)
+
+func (s sortMode) String() string {
+	return [...]string{"name", "date", "size", "last read"}[s]
+}
+
+func (s sortMode) next() sortMode {
+	return (s + 1) % (sortByLastRead + 1)
+}
+
+// sortItems sorts the items in place, ".." then directories first. Dates,
+// sizes and reading times are sorted newest or largest first.
+func sortItems(items []list.Item, mode sortMode) {
+	lastRead := func(i item) time.Time {
+		s, _ := history.get(i.path())
+		return s.LastRead
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		x, y := items[a].(item), items[b].(item)
+		if x.isParent() != y.isParent() {
+			return x.isParent()
+		}
+		if x.IsDir != y.IsDir {
+			return x.IsDir
+		}
+		switch mode {
+		case sortByDate:
+			if !x.ModTime.Equal(y.ModTime) {
+				return x.ModTime.After(y.ModTime)
+			}
+		case sortBySize:
+			if x.Size != y.Size {
+				return x.Size > y.Size
+			}
+		case sortByLastRead:
+			if tx, ty := lastRead(x), lastRead(y); !tx.Equal(ty) {
+				return tx.After(ty)
+			}
+		}
+		return strings.ToLower(x.Name) < strings.ToLower(y.Name)
+	})
+}
+
+// readDirItems lists the directories and PDFs of dir, with a ".." entry
+// unless dir is the root. Symbolic links are followed: a link to a
+// directory is browsed like one and a link to a PDF opens it.
+func readDirItems(dir string, showHidden bool) ([]list.Item, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	items := []list.Item{}
+	if filepath.Dir(dir) != dir {
+		items = append(items, item{Dir: dir, Name: "..", IsDir: true})
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !showHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		i := item{Dir: dir, Name: name, IsDir: entry.IsDir()}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			i.Link, _ = os.Readlink(filepath.Join(dir, name))
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			i.Broken = i.Link != ""
+		} else {
+			i.IsDir = info.IsDir()
+			i.Size = info.Size()
+			i.ModTime = info.ModTime()
+		}
+		if !i.IsDir && !strings.HasSuffix(name, ".pdf") {
+			continue
+		}
+		if !i.IsDir && !i.Broken {
+			i.Title, i.Pages = cachedFileMeta(i.path(), i.ModTime)
+		}
+		items = append(items, i)
+	}
+	return items, nil
+}
+
+// newFileList builds the file browser list for the entries of a directory.
+func newFileList(items []list.Item, mode sortMode) list.Model {
+	sortItems(items, mode)
+
+	l := list.New(items, itemDelegate{}, screenWidth(), listHeight)
+	l.Title = listTitle(mode)
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(true)
+	l.Styles.Title = titleStyle
+	l.Styles.PaginationStyle = paginationStyle
+	l.Styles.HelpStyle = helpStyle
+	return l
+}
+
+func listTitle(mode sortMode) string {
+	return "Lumus · by " + mode.String()
+}
+
+// browser lists one directory at a time. It tracks its own path instead of
+// changing the working directory of the process, so any number of them
+// can exist.
+type browser struct {
+	Dir        string
+	List       list.Model
+	SortMode   sortMode
+	ShowHidden bool
+	// modification time of Dir when it was read, files added since are
+	// picked up by the watcher
+	DirModTime time.Time
+	// name of the selected entry in every visited directory, restored
+	// when coming back to it
+	cursors map[string]string
+}
+
+func newBrowser(dir string, mode sortMode) (browser, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return browser{}, err
+	}
+	items, err := readDirItems(dir, false)
+	if err != nil {
+		return browser{}, err
+	}
+	return browser{Dir: dir, List: newFileList(items, mode), SortMode: mode, cursors: make(map[string]string)}, nil
+}
+
+// open moves the browser to dir. A directory that cannot be read leaves
+// the browser where it was.
+func (b *browser) open(dir string) (tea.Cmd, error) {
+	dir = filepath.Clean(dir)
+	items, err := readDirItems(dir, b.ShowHidden)
+	if err != nil {
+		return nil, err
+	}
+	from := b.Dir
+	if i, ok := b.List.SelectedItem().(item); ok {
+		b.cursors[from] = i.Name
+	}
+	b.Dir = dir
+	b.DirModTime = time.Time{}
+	if info, err := os.Stat(dir); err == nil {
+		b.DirModTime = info.ModTime()
+	}
+	b.List = newFileList(items, b.SortMode)
+	selected, ok := b.cursors[dir]
+	// coming up from a subdirectory not seen before, select it
+	if !ok && filepath.Dir(from) == dir {
+		selected = filepath.Base(from)
+	}
+	b.selectName(selected)
+	return loadFileMetaCmd(b.List), nil
+}
+
+// reload reads the directory again, keeping the selection.
+func (b *browser) reload() (tea.Cmd, error) {
+	return b.open(b.Dir)
+}
+
+func (b *browser) selectName(name string) {
+	for idx, li := range b.List.Items() {
+		if li.(item).Name == name {
+			b.List.Select(idx)
+			return
+		}
+	}
+}
+
+// FileMetaMsg carries the metadata read from a PDF of the directory Dir.
+type FileMetaMsg struct {
+	Dir   string
+	Name  string
+	Title string
+	Pages int
+}
+
+type fileMetaKey struct {
+	Path    string
+	ModTime time.Time
+}
+
+type fileMeta struct {
+	Title string
+	Pages int
+}
+
+var (
+	fileMetaMu    sync.Mutex
+	fileMetaCache = make(map[fileMetaKey]fileMeta)
+	// limits the number of PDFs opened at the same time
+	fileMetaSem = make(chan struct{}, 4)
+)
+
+func cachedFileMeta(path string, modTime time.Time) (string, int) {
+	fileMetaMu.Lock()
+	defer fileMetaMu.Unlock()
+	meta := fileMetaCache[fileMetaKey{path, modTime}]
+	return meta.Title, meta.Pages
+}
+
+// loadFileMetaCmd reads the title and page count of the PDFs in the list
+// that are not cached yet.
+func loadFileMetaCmd(l list.Model) tea.Cmd {
+	var cmds []tea.Cmd
+	for _, li := range l.Items() {
+		i := li.(item)
+		if i.IsDir || i.Broken || i.Pages > 0 {
+			continue
+		}
+		path, dir, name, modTime := i.path(), i.Dir, i.Name, i.ModTime
+		cmds = append(cmds, func() tea.Msg {
+			fileMetaSem <- struct{}{}
+			defer func() { <-fileMetaSem }()
+			title, pages := readFileMeta(path)
+			fileMetaMu.Lock()
+			fileMetaCache[fileMetaKey{path, modTime}] = fileMeta{title, pages}
+			fileMetaMu.Unlock()
+			return FileMetaMsg{Dir: dir, Name: name, Title: title, Pages: pages}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+func readFileMeta(path string) (title string, pages int) {
+	// the pdf reader panics on some malformed files
+	defer func() {
+		if recover() != nil {
+			title, pages = "", 0
+		}
+	}()
+	f, r, err := openPDF(path)
+	if err != nil {
+		return "", 0
+	}
+	defer f.Close()
+	return strings.TrimSpace(r.Trailer().Key("Info").Key("Title").Text()), r.NumPage()
+}
+
+func (m model) handleFileMetaMsg(msg FileMetaMsg) (tea.Model, tea.Cmd) {
+	if msg.Dir != m.Dir {
+		return m, nil
+	}
+	for idx, li := range m.List.Items() {
+		i := li.(item)
+		if i.Name == msg.Name {
+			i.Title, i.Pages = msg.Title, msg.Pages
+			return m, m.List.SetItem(idx, i)
+		}
+	}
+	return m, nil
+}
+
+func (m model) handleSortKey() (tea.Model, tea.Cmd) {
+	if m.ReadingMode {
+		return m, nil
+	}
+	m.SortMode = m.SortMode.next()
+	items := m.List.Items()
+	sortItems(items, m.SortMode)
+	m.List.Title = listTitle(m.SortMode)
+	cmd := m.List.SetItems(items)
+	return m, cmd
+}
+
+func (m model) handleHiddenKey() (tea.Model, tea.Cmd) {
+	if m.ReadingMode {
+		return m, nil
+	}
+	m.ShowHidden = !m.ShowHidden
+	cmd, err := m.reload()
+	if err != nil {
+		m.ShowHidden = !m.ShowHidden
+		return m.showError("read directory "+m.Dir, err)
+	}
+	return m, cmd
+}
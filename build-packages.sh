@@ -11,7 +11,7 @@ DIST_DIR="dist"
 mkdir -p $BUILD_DIR $DIST_DIR
 
 echo "Building for Linux..."
-GOOS=linux GOARCH=amd64 go build -o $BUILD_DIR/$NAME lumus.go
+GOOS=linux GOARCH=amd64 go build -o $BUILD_DIR/$NAME .
 
 # Criar tarball
 echo "Creating distribution tarball..."
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// pageKey identifies an extracted page. The modification time makes a
+// rewritten file miss the cache and the width is part of the key because
+// the text is wrapped to the screen.
+type pageKey struct {
+	Path             string
+	ModTime          int64
+	Page             int
+	Width            int
+	KeepRunningLines bool
+}
+
+type cachedPage struct {
+	Page       pageText
+	TotalPages int
+}
+
+// lruCache is a least recently used cache, safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// pageCache caches extracted pages.
+type pageCache = lruCache[pageKey, cachedPage]
+
+// pages caches the pages read by readPDFPage.
+var pages = newPageCache(defaultConfig().CacheSize)
+
+func newPageCache(size int) *pageCache {
+	return newLRUCache[pageKey, cachedPage](size)
+}
+
+func newLRUCache[K comparable, V any](size int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		size:  size,
+		order: list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(lruEntry[K, V]).value, true
+}
+
+func (c *lruCache[K, V]) put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		e.Value = lruEntry[K, V]{key, value}
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(lruEntry[K, V]{key, value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(lruEntry[K, V]).key)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runCommand runs a subcommand such as "lumus config dump" instead of the
+// interactive reader.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "config":
+		if len(args) == 2 && args[1] == "dump" {
+			return conf.dump(os.Stdout)
+		}
+		return fmt.Errorf("usage: lumus config dump")
+	case "info":
+		return runInfo(args[1:])
+	case "library":
+		return runLibrary(args[1:])
+	case "search":
+		return runSearch(args[1:])
+	case "diff":
+		return runDiff(args[1:])
+	case "serve":
+		return runServe(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "convert":
+		return runConvert(args[1:])
+	case "ocr":
+		return runOCR(args[1:])
+	case "searchable":
+		return runSearchable(args[1:])
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// runInfo prints the properties of a PDF: lumus info [--json] file.pdf
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the properties as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// accept the flag after the file too: lumus info file.pdf --json
+	files := fs.Args()
+	if len(files) == 2 && files[1] == "--json" {
+		files, *asJSON = files[:1], true
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("usage: lumus info [--json] file.pdf")
+	}
+	info, err := readDocInfo(files[0])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	fmt.Print(info)
+	return nil
+}
+
+// runLibrary manages the library folders:
+//
+//	lumus library add dir...
+//	lumus library remove dir...
+//	lumus library scan
+//	lumus library list
+func runLibrary(args []string) error {
+	usage := fmt.Errorf("usage: lumus library add|remove dir... | scan | list")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "add", "remove":
+		if len(args) < 2 {
+			return usage
+		}
+		for _, dir := range args[1:] {
+			update := lib.addRoot
+			if args[0] == "remove" {
+				update = lib.removeRoot
+			}
+			if err := update(dir); err != nil {
+				return err
+			}
+		}
+	case "scan":
+		if len(args) != 1 {
+			return usage
+		}
+	case "list":
+		for _, root := range lib.roots() {
+			fmt.Println("#", root)
+		}
+		for _, d := range lib.docs() {
+			fmt.Printf("%s\t%s\t%d\t%s\n", d.displayTitle(), d.Author, d.Pages, d.Path)
+		}
+		return nil
+	default:
+		return usage
+	}
+	stats, err := lib.scan()
+	fmt.Println("Library:", stats)
+	if err != nil {
+		return err
+	}
+	indexStats, err := openIndex().update(lib.docs())
+	fmt.Println("Search index:", indexStats)
+	return err
+}
+
+// runSearch prints the pages of the library matching a query:
+// lumus search [--limit n] [--json] query
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "Number of results, 0 for all")
+	asJSON := fs.Bool("json", false, "Print the results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		return fmt.Errorf(`usage: lumus search [--limit n] [--json] 'word "a phrase" prefix*'`)
+	}
+	idx := openIndex()
+	if len(idx.Docs) == 0 {
+		return fmt.Errorf("the search index is empty, add folders with: lumus library add ~/Books")
+	}
+	results := idx.search(query, *limit)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	for _, r := range results {
+		fmt.Printf("%s  p. %d  (%.2f)\n    %s\n", r.Path, r.Page, r.Score, r.Snippet)
+	}
+	if len(results) == 0 {
+		fmt.Println("No results.")
+	}
+	return nil
+}
+
+// runDiff compares two versions of a document:
+// lumus diff [--words|--unified] old.pdf new.pdf
+// On a terminal the diff is shown in the reader unless a text format is
+// asked for.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	words := fs.Bool("words", false, "Print the changed words, [-deleted-] and {+inserted+}")
+	unified := fs.Bool("unified", false, "Print a unified line diff")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: lumus diff [--words|--unified] old.pdf new.pdf")
+	}
+	oldPath, newPath := fs.Arg(0), fs.Arg(1)
+	if !*words && !*unified && isTerminal(os.Stdout) {
+		keys, _ := newKeyMap(conf.Keymap, conf.Keys)
+		m := initialModel(keys, ".")
+		m.ShowSwitcher = false
+		m, _ = m.startDiff(oldPath, newPath)
+		return runReader(m)
+	}
+	d, err := compareDocs(oldPath, newPath, *unified)
+	if err != nil {
+		return err
+	}
+	if *unified {
+		fmt.Print(d.unifiedDiff())
+		return nil
+	}
+	text, _ := d.wordDiff(0)
+	if text != "" {
+		fmt.Println(text)
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+type config struct {
+	// color theme: auto, dark, light, sepia, high-contrast or a file in
+	// the themes directory
+	Theme string `toml:"theme"`
+	// keymap preset: default, vim or less
+	Keymap string `toml:"keymap"`
+	// per action overrides of the preset, e.g. next_page = ["l", "right"]
+	Keys map[string][]string `toml:"keys"`
+	// tesseract languages used by the OCR fallback
+	OCRLanguages []string `toml:"ocr_languages"`
+	// extractors tried in order until one returns text: docconv, text, ocr
+	ExtractionOrder []string `toml:"extraction_order"`
+	// number of extracted pages kept in memory, 0 disables the cache
+	CacheSize int `toml:"cache_size"`
+	// show the preview pane next to the file list at startup
+	Preview bool `toml:"preview"`
+	// directory opened at startup, the working directory when empty
+	StartDir string `toml:"start_dir"`
+	// scroll both panes of the split view together
+	SyncScroll bool `toml:"sync_scroll"`
+	// open the quick switcher on the recent documents at startup
+	RecentAtStart bool `toml:"recent_at_start"`
+	// read the open document again when it is rewritten, and the
+	// browser when files are added
+	AutoReload bool `toml:"auto_reload"`
+	// command run by inverse search, %f is the source file and %l the
+	// line, e.g. "nvim --remote +%l %f"; $EDITOR +%l %f when empty
+	SynctexEditor string `toml:"synctex_editor"`
+	// how long the loading animation is shown after opening a page
+	LoadingDelay duration `toml:"loading_delay"`
+	// high performance rendering of the viewport
+	HighPerformanceRenderer bool `toml:"high_performance_renderer"`
+}
+
+// duration is a time.Duration written as "4s" in the config file.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// conf is the effective configuration, set once at startup.
+var conf = defaultConfig()
+
+func defaultConfig() config {
+	return config{
+		Theme:  "auto",
+		Keymap: "default",
+		// English, Spanish and Brazilian Portuguese
+		OCRLanguages:    []string{"eng", "spa", "por+por"},
+		ExtractionOrder: []string{"docconv", "ocr"},
+		CacheSize:       64,
+		RecentAtStart:   true,
+		AutoReload:      true,
+		LoadingDelay:    duration{4 * time.Second},
+	}
+}
+
+// configDir returns $XDG_CONFIG_HOME/lumus, falling back to ~/.config
+// when XDG_CONFIG_HOME is not set.
+func configDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "lumus")
+}
+
+func configPath() string {
+	return filepath.Join(configDir(), "config.toml")
+}
+
+// loadConfig reads the config file over the defaults and validates the
+// result. A missing file is only an error when it was given explicitly.
+func loadConfig(path string, explicit bool) (config, error) {
+	cfg := defaultConfig()
+	var err error
+	if themes, err = loadThemes(themesDir()); err != nil {
+		return cfg, err
+	}
+	if path == "" {
+		return cfg, cfg.validate()
+	}
+	md, err := toml.DecodeFile(path, &cfg)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return cfg, cfg.validate()
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		var names []string
+		for _, key := range undecoded {
+			names = append(names, key.String())
+		}
+		return cfg, fmt.Errorf("%s: unknown keys: %s", path, strings.Join(names, ", "))
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c config) validate() error {
+	var errs []error
+	if _, ok := themes[c.Theme]; !ok {
+		errs = append(errs, fmt.Errorf("theme: unknown theme %q (available: %s)", c.Theme, strings.Join(themeNames(), ", ")))
+	}
+	if _, err := newKeyMap(c.Keymap, c.Keys); err != nil {
+		errs = append(errs, fmt.Errorf("keys: %w", err))
+	}
+	if len(c.OCRLanguages) == 0 {
+		errs = append(errs, errors.New("ocr_languages: at least one language is required"))
+	}
+	if len(c.ExtractionOrder) == 0 {
+		errs = append(errs, errors.New("extraction_order: at least one extractor is required"))
+	}
+	seen := make(map[string]bool)
+	for _, name := range c.ExtractionOrder {
+		if _, ok := extractors[name]; !ok {
+			errs = append(errs, fmt.Errorf("extraction_order: unknown extractor %q (available: %s)", name, strings.Join(extractorNames(), ", ")))
+		} else if seen[name] {
+			errs = append(errs, fmt.Errorf("extraction_order: %q is listed twice", name))
+		}
+		seen[name] = true
+	}
+	if c.CacheSize < 0 {
+		errs = append(errs, fmt.Errorf("cache_size: must not be negative, got %d", c.CacheSize))
+	}
+	if c.StartDir != "" {
+		if info, err := os.Stat(expandHome(c.StartDir)); err != nil {
+			errs = append(errs, fmt.Errorf("start_dir: %w", err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("start_dir: %s is not a directory", c.StartDir))
+		}
+	}
+	if c.LoadingDelay.Duration < 0 {
+		errs = append(errs, fmt.Errorf("loading_delay: must not be negative, got %s", c.LoadingDelay))
+	}
+	return errors.Join(errs...)
+}
+
+// dump writes the effective config, including the resolved key bindings.
+func (c config) dump(w io.Writer) error {
+	keys, err := newKeyMap(c.Keymap, c.Keys)
+	if err != nil {
+		return err
+	}
+	c.Keys = make(map[string][]string)
+	for name, b := range keys.bindings() {
+		c.Keys[name] = b.Keys()
+	}
+	return toml.NewEncoder(w).Encode(c)
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
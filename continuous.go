@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maximum number of pages kept in the viewport in continuous mode
+const windowSize = 5
+
+type windowPage struct {
+	Page    int
+	Content string
+	// lines of the content, plus the page separator
+	Lines int
+}
+
+// LoadWindowPageMsg asks for a page to be added to the continuous window,
+// after the last page or, with Prepend, before the first one.
+type LoadWindowPageMsg struct {
+	FileName string
+	Page     int
+	Prepend  bool
+}
+
+func newWindowPage(page int, content string) windowPage {
+	content = strings.TrimRight(content, "\n")
+	return windowPage{Page: page, Content: content, Lines: strings.Count(content, "\n") + 2}
+}
+
+func (m *model) setWindowContent() {
+	blocks := make([]string, len(m.Window))
+	for i, p := range m.Window {
+		blocks[i] = mutedStyle.Render(fmt.Sprintf("  ── %d ──", p.Page)) + "\n" + p.Content
+	}
+	m.Content = strings.Join(blocks, "\n")
+	m.Viewport.SetContent(m.Content)
+}
+
+// visiblePage returns the page shown on the first line of the viewport.
+func (m model) visiblePage() int {
+	if !m.Continuous || len(m.Window) == 0 {
+		return m.CurrentPage
+	}
+	offset := m.Viewport.YOffset
+	for _, p := range m.Window {
+		if offset < p.Lines {
+			return p.Page
+		}
+		offset -= p.Lines
+	}
+	return m.Window[len(m.Window)-1].Page
+}
+
+// pageOffset returns how far the viewport is scrolled into the visible
+// page, its separator included in continuous scroll.
+func (m model) pageOffset() int {
+	offset := m.Viewport.YOffset
+	if !m.Continuous || len(m.Window) == 0 {
+		return offset
+	}
+	for _, p := range m.Window {
+		if offset < p.Lines {
+			return offset
+		}
+		offset -= p.Lines
+	}
+	return 0
+}
+
+// pageLines returns the number of lines of the visible page.
+func (m model) pageLines() int {
+	if !m.Continuous || len(m.Window) == 0 {
+		return m.Viewport.TotalLineCount()
+	}
+	page := m.visiblePage()
+	for _, p := range m.Window {
+		if p.Page == page {
+			return p.Lines
+		}
+	}
+	return 0
+}
+
+// windowEdgeCmd loads the neighbouring page when the viewport reaches the
+// top or the bottom of the window.
+func (m *model) windowEdgeCmd() tea.Cmd {
+	if !m.Continuous || m.WindowLoading || len(m.Window) == 0 {
+		return nil
+	}
+	fileName := m.FileName
+	if m.Viewport.AtBottom() {
+		last := m.Window[len(m.Window)-1].Page
+		if last < m.TotalPages {
+			m.WindowLoading = true
+			return func() tea.Msg {
+				return LoadWindowPageMsg{FileName: fileName, Page: last + 1}
+			}
+		}
+	}
+	if m.Viewport.AtTop() {
+		first := m.Window[0].Page
+		if first > 1 {
+			m.WindowLoading = true
+			return func() tea.Msg {
+				return LoadWindowPageMsg{FileName: fileName, Page: first - 1, Prepend: true}
+			}
+		}
+	}
+	return nil
+}
+
+func (m model) handleLoadWindowPageMsg(msg LoadWindowPageMsg) (tea.Model, tea.Cmd) {
+	m.WindowLoading = false
+	// the page of a tab that is no longer shown
+	if msg.FileName != m.FileName {
+		return m, nil
+	}
+	if !m.Continuous || !m.ReadingMode {
+		return m, nil
+	}
+	content, _, err := readPDFPage(msg.FileName, msg.Page, m.ShowRunningLines, m.textWidth())
+	if err != nil {
+		content = fmt.Sprintf("Error reading file %s : %v", msg.FileName, err)
+	}
+	if len(m.Highlight) > 0 {
+		content, _ = highlightMatches(content, m.Highlight)
+	}
+	page := newWindowPage(msg.Page, content)
+
+	offset := m.Viewport.YOffset
+	if msg.Prepend {
+		m.Window = append([]windowPage{page}, m.Window...)
+		offset += page.Lines
+		if len(m.Window) > windowSize {
+			m.Window = m.Window[:windowSize]
+		}
+	} else {
+		m.Window = append(m.Window, page)
+		if len(m.Window) > windowSize {
+			offset -= m.Window[0].Lines
+			m.Window = m.Window[1:]
+		}
+	}
+	m.setWindowContent()
+	m.Viewport.SetYOffset(offset)
+	m.CurrentPage = m.visiblePage()
+	return m, nil
+}
+
+func (m model) handleContinuousKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode {
+		return m, nil
+	}
+	m.CurrentPage = m.visiblePage()
+	m.Continuous = !m.Continuous
+	m.Window = nil
+	return m, func() tea.Msg {
+		return LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage}
+	}
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/text/language"
+)
+
+// An EPUB is a zip of XHTML chapters, a package document listing them
+// with the metadata, and a navigation document. The chapters follow the
+// top of the outline, the pages keep a page break marker each, listed in
+// the page-list of the navigation so that page references still work.
+
+// pagesPerChapter splits a document without outline.
+const pagesPerChapter = 25
+
+// epubImage is an image of a page, by the name it has in the EPUB.
+type epubImage struct {
+	Name      string
+	MediaType string
+	Data      []byte
+}
+
+// epubChapter is a file of consecutive pages.
+type epubChapter struct {
+	Name      string
+	Title     string
+	FirstPage int
+	LastPage  int
+}
+
+type epubBook struct {
+	doc      *exportDoc
+	info     docInfo
+	chapters []epubChapter
+	// images of each page, in the order pdfcpu found them
+	images map[int][]epubImage
+	// images whose format e-readers can't show
+	skipped int
+}
+
+// runConvert converts a PDF to a reflowable EPUB:
+// lumus convert book.pdf book.epub
+func runConvert(args []string) error {
+	if len(args) != 2 || !strings.EqualFold(filepath.Ext(args[1]), ".epub") {
+		return errors.New("usage: lumus convert book.pdf book.epub")
+	}
+	var progress func(page, total int)
+	if isTerminal(os.Stderr) {
+		progress = func(page, total int) {
+			fmt.Fprintf(os.Stderr, "\rReading page %d/%d", page, total)
+		}
+	}
+	doc, err := readExportDoc(args[0], progress)
+	if progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	b := newEPUBBook(doc)
+	if err := writeFileAtomic(args[1], b.write); err != nil {
+		return err
+	}
+	fmt.Printf("Converted %d pages to %s, %d chapters\n", len(doc.Pages), args[1], len(b.chapters))
+	if b.skipped > 0 {
+		fmt.Printf("%d images left out, in formats EPUB can't hold\n", b.skipped)
+	}
+	return nil
+}
+
+func newEPUBBook(doc *exportDoc) *epubBook {
+	b := &epubBook{doc: doc}
+	info, err := readDocInfo(doc.Path)
+	if err != nil {
+		log.Printf("convert %s: metadata: %v", doc.Path, err)
+	}
+	b.info = info
+	if b.info.Title == "" {
+		b.info.Title = doc.Title
+	}
+	if b.info.Author == "" {
+		b.info.Author = doc.Author
+	}
+	b.chapters = splitChapters(doc)
+	b.images, b.skipped = readPageImages(doc.Path)
+	return b
+}
+
+// splitChapters starts a chapter at every top entry of the outline, or
+// every pagesPerChapter pages without one.
+func splitChapters(doc *exportDoc) []epubChapter {
+	total := len(doc.Pages)
+	titles := make(map[int]string)
+	var starts []int
+	for _, e := range doc.Outline {
+		if e.Level == 0 && e.Page >= 1 && e.Page <= total {
+			if _, ok := titles[e.Page]; !ok {
+				starts = append(starts, e.Page)
+				titles[e.Page] = e.Title
+			}
+		}
+	}
+	if len(starts) == 0 {
+		for p := 1; p <= total; p += pagesPerChapter {
+			starts = append(starts, p)
+		}
+	}
+	sort.Ints(starts)
+	if starts[0] != 1 {
+		starts = append([]int{1}, starts...)
+	}
+	chapters := make([]epubChapter, len(starts))
+	for i, first := range starts {
+		last := total
+		if i+1 < len(starts) {
+			last = starts[i+1] - 1
+		}
+		title := titles[first]
+		if title == "" {
+			title = fmt.Sprintf("Pages %d–%d", first, last)
+		}
+		chapters[i] = epubChapter{Name: fmt.Sprintf("chapter-%03d.xhtml", i+1), Title: title, FirstPage: first, LastPage: last}
+	}
+	return chapters
+}
+
+// chapterOf returns the file holding a page.
+func (b *epubBook) chapterOf(page int) string {
+	for _, c := range b.chapters {
+		if page <= c.LastPage {
+			return c.Name
+		}
+	}
+	return b.chapters[len(b.chapters)-1].Name
+}
+
+// readPageImages extracts the images of every page, JPEGs as they are
+// stored and the others as PNG. An image shown on several pages is kept
+// once. The count of images left out is returned too.
+func readPageImages(path string) (map[int][]epubImage, int) {
+	images := make(map[int][]epubImage)
+	f, err := os.Open(path)
+	if err != nil {
+		return images, 0
+	}
+	defer f.Close()
+	pages, err := api.ExtractImagesRaw(f, nil, pdfcpuConfig(path))
+	if err != nil {
+		log.Printf("convert %s: images: %v", path, err)
+		return images, 0
+	}
+	seen := make(map[int]epubImage)
+	skipped := 0
+	for _, page := range pages {
+		// sorted by object for a stable book
+		var objNrs []int
+		for nr := range page {
+			objNrs = append(objNrs, nr)
+		}
+		sort.Ints(objNrs)
+		for _, nr := range objNrs {
+			img := page[nr]
+			if img.Thumb || img.IsImgMask || img.Reader == nil {
+				continue
+			}
+			if e, ok := seen[nr]; ok {
+				images[img.PageNr] = append(images[img.PageNr], e)
+				continue
+			}
+			var mediaType string
+			switch img.FileType {
+			case "jpg":
+				mediaType = "image/jpeg"
+			case "png":
+				mediaType = "image/png"
+			default:
+				skipped++
+				continue
+			}
+			data, err := io.ReadAll(img)
+			if err != nil {
+				skipped++
+				continue
+			}
+			e := epubImage{Name: fmt.Sprintf("image-%d.%s", nr, img.FileType), MediaType: mediaType, Data: data}
+			seen[nr] = e
+			images[img.PageNr] = append(images[img.PageNr], e)
+		}
+	}
+	return images, skipped
+}
+
+type epubFile struct {
+	name string
+	data []byte
+}
+
+// write writes the zip, the mimetype first and stored as the OCF
+// container requires.
+func (b *epubBook) write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	mimetype := []byte("application/epub+zip")
+	mw, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(mimetype); err != nil {
+		return err
+	}
+	files := []epubFile{
+		{"META-INF/container.xml", []byte(epubContainer)},
+		{"OEBPS/content.opf", b.packageDocument()},
+		{"OEBPS/nav.xhtml", b.navDocument()},
+		{"OEBPS/style.css", []byte(epubStyle)},
+	}
+	for i, c := range b.chapters {
+		files = append(files, epubFile{"OEBPS/text/" + c.Name, b.chapterDocument(i)})
+	}
+	for _, img := range b.uniqueImages() {
+		files = append(files, epubFile{"OEBPS/images/" + img.Name, img.Data})
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (b *epubBook) uniqueImages() []epubImage {
+	var unique []epubImage
+	seen := make(map[string]bool)
+	for p := 1; p <= len(b.doc.Pages); p++ {
+		for _, img := range b.images[p] {
+			if !seen[img.Name] {
+				seen[img.Name] = true
+				unique = append(unique, img)
+			}
+		}
+	}
+	return unique
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const epubStyle = `body { margin: 0 5%; line-height: 1.5; }
+p { margin: 0; text-indent: 1.5em; text-align: justify; }
+h1 + p, h2 + p, h3 + p, h4 + p, h5 + p, h6 + p { text-indent: 0; }
+figure { margin: 1em 0; text-align: center; }
+img { max-width: 100%; }
+`
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+// xmlEscape escapes s for XML text and attributes. Control characters,
+// common in extracted text, are not allowed in XML: form and vertical
+// feeds become spaces, the others are dropped.
+func xmlEscape(s string) string {
+	return xmlEscaper.Replace(strings.Map(xmlChar, s))
+}
+
+func xmlChar(r rune) rune {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return r
+	case r == '\f' || r == '\v':
+		return ' '
+	case r < 0x20, r >= 0xD800 && r < 0xE000, r == 0xFFFE, r == 0xFFFF:
+		return -1
+	}
+	return r
+}
+
+// epubLanguage is the first OCR language, which is what the library is
+// most likely written in.
+func epubLanguage() string {
+	if len(conf.OCRLanguages) > 0 {
+		code, _, _ := strings.Cut(conf.OCRLanguages[0], "+")
+		if tag, err := language.Parse(code); err == nil {
+			return tag.String()
+		}
+	}
+	return "und"
+}
+
+// epubIdentifier derives a stable urn:uuid from the content of the PDF,
+// so that converting it again updates the same book on the reader.
+func epubIdentifier(path string) string {
+	h, err := fileHash(path)
+	if err != nil || len(h) < 32 {
+		h = fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+}
+
+func (b *epubBook) packageDocument() []byte {
+	var s strings.Builder
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&s, "    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", epubIdentifier(b.doc.Path))
+	fmt.Fprintf(&s, "    <dc:title>%s</dc:title>\n", xmlEscape(b.info.Title))
+	fmt.Fprintf(&s, "    <dc:language>%s</dc:language>\n", epubLanguage())
+	if b.info.Author != "" {
+		fmt.Fprintf(&s, "    <dc:creator>%s</dc:creator>\n", xmlEscape(b.info.Author))
+	}
+	if b.info.Subject != "" {
+		fmt.Fprintf(&s, "    <dc:description>%s</dc:description>\n", xmlEscape(b.info.Subject))
+	}
+	for _, k := range b.info.Keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			fmt.Fprintf(&s, "    <dc:subject>%s</dc:subject>\n", xmlEscape(k))
+		}
+	}
+	if t, ok := types.DateTime(b.info.CreationDate, true); ok {
+		fmt.Fprintf(&s, "    <dc:date>%s</dc:date>\n", t.UTC().Format(time.RFC3339))
+	}
+	modified := time.Now()
+	if fi, err := os.Stat(b.doc.Path); err == nil {
+		modified = fi.ModTime()
+	}
+	fmt.Fprintf(&s, "    <meta property=\"dcterms:modified\">%s</meta>\n", modified.UTC().Format("2006-01-02T15:04:05Z"))
+	if b.info.Creator != "" {
+		fmt.Fprintf(&s, "    <dc:contributor>%s</dc:contributor>\n", xmlEscape(b.info.Creator))
+	}
+	s.WriteString("  </metadata>\n  <manifest>\n")
+	s.WriteString("    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	s.WriteString("    <item id=\"style\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	for i, c := range b.chapters {
+		fmt.Fprintf(&s, "    <item id=\"chapter-%d\" href=\"text/%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, c.Name)
+	}
+	for i, img := range b.uniqueImages() {
+		fmt.Fprintf(&s, "    <item id=\"image-%d\" href=\"images/%s\" media-type=\"%s\"/>\n", i+1, img.Name, img.MediaType)
+	}
+	s.WriteString("  </manifest>\n  <spine>\n")
+	for i := range b.chapters {
+		fmt.Fprintf(&s, "    <itemref idref=\"chapter-%d\"/>\n", i+1)
+	}
+	s.WriteString("  </spine>\n</package>\n")
+	return []byte(s.String())
+}
+
+func xhtmlHeader(title, css string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head>
+<meta charset="utf-8"/>
+<title>%s</title>
+<link rel="stylesheet" type="text/css" href="%s"/>
+</head>
+<body>
+`, xmlEscape(title), css)
+}
+
+// tocAnchor is the id of the heading of an outline entry.
+func tocAnchor(i int) string {
+	return fmt.Sprintf("toc-%d", i+1)
+}
+
+func outlineTitle(e outlineEntry) string {
+	if e.Title == "" {
+		return fmt.Sprintf("Page %d", e.Page)
+	}
+	return e.Title
+}
+
+// navDocument lists the outline, nested as it is in the PDF, and every
+// page.
+func (b *epubBook) navDocument() []byte {
+	var s strings.Builder
+	s.WriteString(xhtmlHeader(b.info.Title, "style.css"))
+	s.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n")
+	entries := b.navEntries()
+	level := 0
+	for i, e := range entries {
+		// a child can't skip levels, and the first entry opens none
+		l := min(e.level, level+1)
+		if i == 0 {
+			l = 0
+		} else if l > level {
+			s.WriteString("\n<ol>\n")
+		} else {
+			s.WriteString("</li>\n")
+			for ; level > l; level-- {
+				s.WriteString("</ol>\n</li>\n")
+			}
+		}
+		level = l
+		fmt.Fprintf(&s, "<li><a href=\"%s\">%s</a>", e.href, xmlEscape(e.title))
+	}
+	if len(entries) > 0 {
+		s.WriteString("</li>\n")
+		for ; level > 0; level-- {
+			s.WriteString("</ol>\n</li>\n")
+		}
+	}
+	s.WriteString("</ol>\n</nav>\n")
+	s.WriteString("<nav epub:type=\"page-list\" hidden=\"\">\n<ol>\n")
+	for _, p := range b.doc.Pages {
+		fmt.Fprintf(&s, "<li><a href=\"text/%s#%s\">%d</a></li>\n", b.chapterOf(p.Page), pageAnchor(p.Page), p.Page)
+	}
+	s.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return []byte(s.String())
+}
+
+type navEntry struct {
+	title string
+	href  string
+	level int
+}
+
+// navEntries is the outline, or the chapters without one.
+func (b *epubBook) navEntries() []navEntry {
+	var entries []navEntry
+	for i, e := range b.doc.Outline {
+		if e.Page < 1 || e.Page > len(b.doc.Pages) {
+			continue
+		}
+		entries = append(entries, navEntry{title: outlineTitle(e), href: "text/" + b.chapterOf(e.Page) + "#" + tocAnchor(i), level: e.Level})
+	}
+	if len(entries) == 0 {
+		for _, c := range b.chapters {
+			entries = append(entries, navEntry{title: c.Title, href: "text/" + c.Name})
+		}
+	}
+	return entries
+}
+
+// chapterDocument writes the pages of a chapter: a page break marker, the
+// headings of the outline, the paragraphs and then the images of each.
+func (b *epubBook) chapterDocument(i int) []byte {
+	c := b.chapters[i]
+	var s strings.Builder
+	s.WriteString(xhtmlHeader(c.Title, "../style.css"))
+	headings := make(map[int][]int)
+	for j, e := range b.doc.Outline {
+		headings[e.Page] = append(headings[e.Page], j)
+	}
+	for p := c.FirstPage; p <= c.LastPage; p++ {
+		fmt.Fprintf(&s, "<span epub:type=\"pagebreak\" role=\"doc-pagebreak\" id=\"%s\" aria-label=\"%d\"></span>\n", pageAnchor(p), p)
+		for _, j := range headings[p] {
+			e := b.doc.Outline[j]
+			level := min(e.Level+1, 6)
+			fmt.Fprintf(&s, "<h%d id=\"%s\">%s</h%d>\n", level, tocAnchor(j), xmlEscape(outlineTitle(e)), level)
+		}
+		for _, para := range paragraphs(b.doc.Pages[p-1].Text) {
+			fmt.Fprintf(&s, "<p>%s</p>\n", xmlEscape(para))
+		}
+		for _, img := range b.images[p] {
+			fmt.Fprintf(&s, "<figure><img src=\"../images/%s\" alt=\"\"/></figure>\n", img.Name)
+		}
+	}
+	s.WriteString("</body>\n</html>\n")
+	return []byte(s.String())
+}
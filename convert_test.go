@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXMLEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`AT&T <b> "q" 'a'`, "AT&amp;T &lt;b&gt; &quot;q&quot; &apos;a&apos;"},
+		{"end of page\fnext", "end of page next"},
+		{"nul\x00 and bell\x07", "nul and bell"},
+		{"tab\tand\nlines\r", "tab\tand\nlines\r"},
+		{"ünïcödé σκάν", "ünïcödé σκάν"},
+		{"\uFFFE\uFFFF", ""},
+	}
+	for _, tt := range tests {
+		if got := xmlEscape(tt.in); got != tt.want {
+			t.Errorf("xmlEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestXMLEscapeWellFormed(t *testing.T) {
+	var raw strings.Builder
+	for r := rune(0); r < 0x80; r++ {
+		raw.WriteRune(r)
+	}
+	doc := "<p>" + xmlEscape(raw.String()) + "</p>"
+	var v struct {
+		Text string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatalf("escaped text is not well-formed: %v", err)
+	}
+}
+
+// wellFormed reports the first error of the XML parser on doc.
+func wellFormed(doc []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestEPUBDocumentsWellFormed(t *testing.T) {
+	doc := &exportDoc{
+		Path:  filepath.Join(t.TempDir(), "book.pdf"),
+		Title: "A <Book>",
+		// the part has no page, its chapters come first
+		Outline: []outlineEntry{{"Part", 0, 0}, {"A", 1, 1}, {"B", 2, 1}, {"B.1", 2, 3}, {"C", 3, 0}},
+		Pages: []exportPage{
+			{Page: 1, Text: "First & second\f"},
+			{Page: 2, Text: "Some <text>"},
+			{Page: 3, Text: "End"},
+		},
+	}
+	b := &epubBook{doc: doc, info: docInfo{Title: doc.Title}, chapters: splitChapters(doc), images: make(map[int][]epubImage)}
+	if err := wellFormed(b.navDocument()); err != nil {
+		t.Errorf("navDocument: %v\n%s", err, b.navDocument())
+	}
+	if err := wellFormed(b.packageDocument()); err != nil {
+		t.Errorf("packageDocument: %v\n%s", err, b.packageDocument())
+	}
+	for i := range b.chapters {
+		if err := wellFormed(b.chapterDocument(i)); err != nil {
+			t.Errorf("chapterDocument(%d): %v\n%s", i, err, b.chapterDocument(i))
+		}
+	}
+}
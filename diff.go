@@ -0,0 +1,516 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// diffToken is a line or a word of a document and the page it is on.
+type diffToken struct {
+	Text string
+	Page int
+}
+
+type diffOp int
+
+const (
+	opEqual diffOp = iota
+	opDelete
+	opInsert
+)
+
+// diffEdit turns the old tokens into the new ones. A and B are the
+// positions in the old and new tokens before the edit: the token is
+// Old[A] for a deletion, New[B] for an insertion, and both for an equal
+// token.
+type diffEdit struct {
+	Op   diffOp
+	A, B int
+}
+
+// docDiff compares two documents token by token.
+type docDiff struct {
+	OldName, NewName string
+	Old, New         []diffToken
+	Edits            []diffEdit
+}
+
+// tokenize splits the pages into lines.
+func tokenize(pages []string) []diffToken {
+	var tokens []diffToken
+	for i, text := range pages {
+		for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+			tokens = append(tokens, diffToken{Text: strings.TrimRight(line, " \t"), Page: i + 1})
+		}
+	}
+	return tokens
+}
+
+// compareDocs extracts both documents through the reader pipeline and
+// diffs them by line, or by word. The words are only compared within the
+// lines that changed, which keeps a long document cheap.
+func compareDocs(oldPath, newPath string, byLine bool) (*docDiff, error) {
+	oldPages, err := readPages(oldPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", oldPath, err)
+	}
+	newPages, err := readPages(newPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", newPath, err)
+	}
+	d := &docDiff{OldName: oldPath, NewName: newPath, Old: tokenize(oldPages), New: tokenize(newPages)}
+	d.Edits = diffTokens(d.Old, d.New)
+	if !byLine {
+		d.Old, d.New, d.Edits = wordEdits(d.Old, d.New, d.Edits)
+	}
+	return d, nil
+}
+
+// wordEdits turns a line diff into a word diff.
+func wordEdits(oldLines, newLines []diffToken, lineEdits []diffEdit) (oldWords, newWords []diffToken, edits []diffEdit) {
+	words := func(line diffToken) []diffToken {
+		var tokens []diffToken
+		for _, w := range strings.Fields(line.Text) {
+			tokens = append(tokens, diffToken{Text: w, Page: line.Page})
+		}
+		return tokens
+	}
+	for i := 0; i < len(lineEdits); {
+		if e := lineEdits[i]; e.Op == opEqual {
+			newLine := words(newLines[e.B])
+			for j, w := range words(oldLines[e.A]) {
+				edits = append(edits, diffEdit{Op: opEqual, A: len(oldWords), B: len(newWords)})
+				oldWords = append(oldWords, w)
+				newWords = append(newWords, newLine[j])
+			}
+			i++
+			continue
+		}
+		var deleted, inserted []diffToken
+		for ; i < len(lineEdits) && lineEdits[i].Op != opEqual; i++ {
+			if e := lineEdits[i]; e.Op == opDelete {
+				deleted = append(deleted, words(oldLines[e.A])...)
+			} else {
+				inserted = append(inserted, words(newLines[e.B])...)
+			}
+		}
+		for _, e := range diffTokens(deleted, inserted) {
+			e.A += len(oldWords)
+			e.B += len(newWords)
+			edits = append(edits, e)
+		}
+		oldWords = append(oldWords, deleted...)
+		newWords = append(newWords, inserted...)
+	}
+	return oldWords, newWords, edits
+}
+
+// beyond this many differences a diff gives up on finding the shortest
+// edit script and compares the documents page by page, the time it takes
+// grows with the differences times the length
+const maxDiffCost = 4000
+
+// diffTokens finds a shortest edit script with Myers' algorithm, in the
+// linear space variant that splits the tokens at the middle snake.
+func diffTokens(a, b []diffToken) []diffEdit {
+	var edits []diffEdit
+	if !myers(a, b, 0, 0, &edits) {
+		return pageEdits(a, b)
+	}
+	return groupChanges(edits)
+}
+
+// myers appends the edits turning a into b, which start at positions aoff
+// and boff of the whole old and new tokens. It returns false when they
+// differ by more than maxDiffCost.
+func myers(a, b []diffToken, aoff, boff int, edits *[]diffEdit) bool {
+	head := 0
+	for head < len(a) && head < len(b) && a[head].Text == b[head].Text {
+		*edits = append(*edits, diffEdit{Op: opEqual, A: aoff + head, B: boff + head})
+		head++
+	}
+	a, b, aoff, boff = a[head:], b[head:], aoff+head, boff+head
+	tail := 0
+	for tail < len(a) && tail < len(b) && a[len(a)-1-tail].Text == b[len(b)-1-tail].Text {
+		tail++
+	}
+	a, b = a[:len(a)-tail], b[:len(b)-tail]
+	switch {
+	case len(a) == 0:
+		for j := range b {
+			*edits = append(*edits, diffEdit{Op: opInsert, A: aoff, B: boff + j})
+		}
+	case len(b) == 0:
+		for i := range a {
+			*edits = append(*edits, diffEdit{Op: opDelete, A: aoff + i, B: boff})
+		}
+	default:
+		x, y, ok := middleSnake(a, b)
+		if !ok {
+			return false
+		}
+		if !myers(a[:x], b[:y], aoff, boff, edits) || !myers(a[x:], b[y:], aoff+x, boff+y, edits) {
+			return false
+		}
+	}
+	for i := 0; i < tail; i++ {
+		*edits = append(*edits, diffEdit{Op: opEqual, A: aoff + len(a) + i, B: boff + len(b) + i})
+	}
+	return true
+}
+
+// middleSnake runs the search for a shortest edit script from both ends
+// of a and b at once, keeping only the furthest point of each diagonal,
+// and returns where the two meet. a and b differ in their first and last
+// tokens.
+func middleSnake(a, b []diffToken) (int, int, bool) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	// furthest x of each diagonal k = x - y, from the start and from the
+	// end, -1 until reached
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// diagonals that ran off the edit graph are not searched again
+	kStart, kEnd, rStart, rEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		if 2*d > maxDiffCost {
+			return 0, 0, false
+		}
+		for k := -d + kStart; k <= d-kEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x].Text == b[y].Text {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				kEnd += 2
+			case y > m:
+				kStart += 2
+			case odd:
+				if r := offset + delta - k; r >= 0 && r < len(backward) && backward[r] != -1 && x >= n-backward[r] {
+					return x, y, true
+				}
+			}
+		}
+		for k := -d + rStart; k <= d-rEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1].Text == b[m-y-1].Text {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				rEnd += 2
+			case y > m:
+				rStart += 2
+			case !odd:
+				if f := offset + delta - k; f >= 0 && f < len(forward) && forward[f] != -1 {
+					fx := forward[f]
+					if fx >= n-x {
+						return fx, fx - (f - offset), true
+					}
+				}
+			}
+		}
+	}
+	// nothing in common
+	return n, 0, true
+}
+
+// groupChanges puts the deletions of each change before its insertions,
+// the order in which they are shown.
+func groupChanges(edits []diffEdit) []diffEdit {
+	for i := 0; i < len(edits); {
+		if edits[i].Op == opEqual {
+			i++
+			continue
+		}
+		a, b := edits[i].A, edits[i].B
+		end, deleted := i, 0
+		for ; end < len(edits) && edits[end].Op != opEqual; end++ {
+			if edits[end].Op == opDelete {
+				deleted++
+			}
+		}
+		for j := i; j < end; j++ {
+			if j-i < deleted {
+				edits[j] = diffEdit{Op: opDelete, A: a + j - i, B: b}
+			} else {
+				edits[j] = diffEdit{Op: opInsert, A: a + deleted, B: b + j - i - deleted}
+			}
+		}
+		i = end
+	}
+	return edits
+}
+
+// pageEdits compares documents too different for diffTokens page by
+// page: the pages with the same tokens are equal, the others are replaced
+// whole.
+func pageEdits(a, b []diffToken) []diffEdit {
+	oldPages, newPages := pageSpans(a), pageSpans(b)
+	var pageDiff []diffEdit
+	if !myers(spanTokens(a, oldPages), spanTokens(b, newPages), 0, 0, &pageDiff) {
+		pageDiff = nil
+		for i := range oldPages {
+			pageDiff = append(pageDiff, diffEdit{Op: opDelete, A: i})
+		}
+		for j := range newPages {
+			pageDiff = append(pageDiff, diffEdit{Op: opInsert, A: len(oldPages), B: j})
+		}
+	}
+	var edits []diffEdit
+	ai, bi := 0, 0
+	for _, e := range groupChanges(pageDiff) {
+		switch e.Op {
+		case opEqual:
+			for ; ai < oldPages[e.A][1]; ai, bi = ai+1, bi+1 {
+				edits = append(edits, diffEdit{Op: opEqual, A: ai, B: bi})
+			}
+		case opDelete:
+			for ; ai < oldPages[e.A][1]; ai++ {
+				edits = append(edits, diffEdit{Op: opDelete, A: ai, B: bi})
+			}
+		case opInsert:
+			for ; bi < newPages[e.B][1]; bi++ {
+				edits = append(edits, diffEdit{Op: opInsert, A: ai, B: bi})
+			}
+		}
+	}
+	return edits
+}
+
+// pageSpans returns the bounds of the runs of tokens of each page.
+func pageSpans(tokens []diffToken) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(tokens); {
+		j := i + 1
+		for j < len(tokens) && tokens[j].Page == tokens[i].Page {
+			j++
+		}
+		spans = append(spans, [2]int{i, j})
+		i = j
+	}
+	return spans
+}
+
+// spanTokens makes a token of the text of each span.
+func spanTokens(tokens []diffToken, spans [][2]int) []diffToken {
+	pages := make([]diffToken, len(spans))
+	for i, s := range spans {
+		var text strings.Builder
+		for _, t := range tokens[s[0]:s[1]] {
+			text.WriteString(t.Text)
+			text.WriteString("\n")
+		}
+		pages[i] = diffToken{Text: text.String(), Page: tokens[s[0]].Page}
+	}
+	return pages
+}
+
+// hunks groups the changes with context equal tokens around them, changes
+// closer than twice the context share a hunk. It returns the bounds of
+// each hunk in the edits.
+func hunks(edits []diffEdit, context int) [][2]int {
+	var groups [][2]int
+	for i := 0; i < len(edits); {
+		if edits[i].Op == opEqual {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != opEqual {
+				end++
+				continue
+			}
+			equal := end
+			for equal < len(edits) && edits[equal].Op == opEqual {
+				equal++
+			}
+			if equal == len(edits) || equal-end > 2*context {
+				break
+			}
+			end = equal
+		}
+		stop := min(end+context, len(edits))
+		groups = append(groups, [2]int{start, stop})
+		i = stop
+	}
+	return groups
+}
+
+func pageAt(tokens []diffToken, i int) int {
+	if len(tokens) == 0 {
+		return 0
+	}
+	return tokens[min(i, len(tokens)-1)].Page
+}
+
+// hunkPages returns the pages of the first change of a hunk in both
+// documents.
+func (d *docDiff) hunkPages(h [2]int) (int, int) {
+	for _, e := range d.Edits[h[0]:h[1]] {
+		if e.Op != opEqual {
+			return pageAt(d.Old, e.A), pageAt(d.New, e.B)
+		}
+	}
+	return 0, 0
+}
+
+// words of context around the changes of a word diff
+const wordContext = 8
+
+// wordDiff renders the changed words with some context, a paragraph per
+// hunk headed by its pages, wrapped to width columns unless width is 0.
+// Deleted words are marked [-like this-] and inserted ones {+like this+},
+// colored too on a terminal. It returns the first line of every hunk.
+func (d *docDiff) wordDiff(width int) (string, []int) {
+	w := &wrapper{width: width}
+	var starts []int
+	for _, h := range hunks(d.Edits, wordContext) {
+		if len(starts) > 0 {
+			w.newline()
+			w.newline()
+		}
+		starts = append(starts, w.lines)
+		oldPage, newPage := d.hunkPages(h)
+		w.raw(mutedStyle.Render(fmt.Sprintf("@@ page %d → page %d @@", oldPage, newPage)))
+		w.newline()
+		edits := d.Edits[h[0]:h[1]]
+		for i, e := range edits {
+			switch e.Op {
+			case opEqual:
+				w.word(d.New[e.B].Text, textStyle)
+			case opDelete, opInsert:
+				text, style, open, close := d.Old[e.A].Text, deletedStyle.Render, "[-", "-]"
+				if e.Op == opInsert {
+					text, style, open, close = d.New[e.B].Text, insertedStyle.Render, "{+", "+}"
+				}
+				if i == 0 || edits[i-1].Op != e.Op {
+					text = open + text
+				}
+				if i == len(edits)-1 || edits[i+1].Op != e.Op {
+					text += close
+				}
+				w.word(text, style)
+			}
+		}
+	}
+	return w.String(), starts
+}
+
+// wrapper lays words out in lines of a given width.
+type wrapper struct {
+	strings.Builder
+	width int
+	col   int
+	lines int
+}
+
+func (w *wrapper) word(text string, style func(...string) string) {
+	n := runewidth.StringWidth(text)
+	if w.col > 0 {
+		if w.width > 0 && w.col+1+n > w.width {
+			w.newline()
+		} else {
+			w.WriteString(" ")
+			w.col++
+		}
+	}
+	w.WriteString(style(text))
+	w.col += n
+}
+
+func (w *wrapper) raw(s string) {
+	w.WriteString(s)
+	w.col += runewidth.StringWidth(s)
+}
+
+func (w *wrapper) newline() {
+	w.WriteString("\n")
+	w.col = 0
+	w.lines++
+}
+
+// lines of context of a unified diff
+const lineContext = 3
+
+// unifiedDiff renders a line diff in the unified format of diff -u, the
+// line numbers count the lines of the whole extracted text and every
+// hunk header ends with the pages of its first change.
+func (d *docDiff) unifiedDiff() string {
+	var b strings.Builder
+	groups := hunks(d.Edits, lineContext)
+	if len(groups) == 0 {
+		return ""
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", d.OldName, d.NewName)
+	for _, h := range groups {
+		edits := d.Edits[h[0]:h[1]]
+		oldCount, newCount := 0, 0
+		for _, e := range edits {
+			if e.Op != opInsert {
+				oldCount++
+			}
+			if e.Op != opDelete {
+				newCount++
+			}
+		}
+		oldPage, newPage := d.hunkPages(h)
+		fmt.Fprintf(&b, "@@ -%s +%s @@ page %d → %d\n", hunkRange(edits[0].A, oldCount), hunkRange(edits[0].B, newCount), oldPage, newPage)
+		for _, e := range edits {
+			switch e.Op {
+			case opEqual:
+				b.WriteString(" " + d.New[e.B].Text + "\n")
+			case opDelete:
+				b.WriteString("-" + d.Old[e.A].Text + "\n")
+			case opInsert:
+				b.WriteString("+" + d.New[e.B].Text + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// hunkRange formats the start and length of a side of a hunk, the start
+// of an empty side is the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func diffTitle(oldPath, newPath string) string {
+	return filepath.Base(oldPath) + " → " + filepath.Base(newPath)
+}
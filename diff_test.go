@@ -0,0 +1,177 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func lineTokens(lines string) []diffToken {
+	var tokens []diffToken
+	for _, l := range strings.Fields(lines) {
+		tokens = append(tokens, diffToken{Text: l, Page: 1})
+	}
+	return tokens
+}
+
+// checkEdits tells whether edits turn a into b, with every position where
+// it should be.
+func checkEdits(t *testing.T, a, b []diffToken, edits []diffEdit) {
+	t.Helper()
+	i, j := 0, 0
+	for n, e := range edits {
+		if e.A != i || e.B != j {
+			t.Fatalf("edit %d %+v: expected at %d,%d", n, e, i, j)
+		}
+		switch e.Op {
+		case opEqual:
+			if a[i].Text != b[j].Text {
+				t.Fatalf("edit %d: %q and %q are not equal", n, a[i].Text, b[j].Text)
+			}
+			i++
+			j++
+		case opDelete:
+			i++
+		case opInsert:
+			j++
+		}
+	}
+	if i != len(a) || j != len(b) {
+		t.Fatalf("edits end at %d,%d, want %d,%d", i, j, len(a), len(b))
+	}
+}
+
+func cost(edits []diffEdit) int {
+	n := 0
+	for _, e := range edits {
+		if e.Op != opEqual {
+			n++
+		}
+	}
+	return n
+}
+
+// lcsCost is the cost of a shortest edit script, by dynamic programming.
+func lcsCost(a, b []diffToken) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i].Text == b[j].Text {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return len(a) + len(b) - 2*lcs[0][0]
+}
+
+func TestDiffTokens(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{"", "", ""},
+		{"a b c", "a b c", "= = ="},
+		{"", "a b", "+ +"},
+		{"a b", "", "- -"},
+		{"a b c", "a x c", "= - + ="},
+		{"a b c d", "a c d e", "= - = = +"},
+		{"a b", "c d", "- - + +"},
+		{"x a b c", "a b c y", "- = = = +"},
+	}
+	for _, tt := range tests {
+		a, b := lineTokens(tt.old), lineTokens(tt.new)
+		edits := diffTokens(a, b)
+		checkEdits(t, a, b, edits)
+		var ops []string
+		for _, e := range edits {
+			ops = append(ops, [...]string{"=", "-", "+"}[e.Op])
+		}
+		if got := strings.Join(ops, " "); got != tt.want {
+			t.Errorf("diffTokens(%q, %q) = %s, want %s", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestDiffTokensShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []diffToken {
+		tokens := make([]diffToken, r.Intn(40))
+		for i := range tokens {
+			tokens[i] = diffToken{Text: string(rune('a' + r.Intn(4))), Page: 1}
+		}
+		return tokens
+	}
+	for n := 0; n < 500; n++ {
+		a, b := random(), random()
+		edits := diffTokens(a, b)
+		checkEdits(t, a, b, edits)
+		if got, want := cost(edits), lcsCost(a, b); got != want {
+			t.Fatalf("diffTokens(%v, %v) costs %d, want %d", a, b, got, want)
+		}
+		// deletions come before insertions in every change
+		for i := 1; i < len(edits); i++ {
+			if edits[i-1].Op == opInsert && edits[i].Op == opDelete {
+				t.Fatalf("insertion before deletion at %d", i)
+			}
+		}
+	}
+}
+
+func TestDiffTokensByPage(t *testing.T) {
+	pages := func(seed int64, n int) []diffToken {
+		r := rand.New(rand.NewSource(seed))
+		var tokens []diffToken
+		for p := 1; p <= n; p++ {
+			for l := 0; l < 1000; l++ {
+				tokens = append(tokens, diffToken{Text: string(rune('a' + r.Intn(26))), Page: p})
+			}
+		}
+		return tokens
+	}
+	a, b := pages(1, 6), pages(2, 6)
+	// the same third page in both
+	copy(b[2000:3000], a[2000:3000])
+	edits := diffTokens(a, b)
+	checkEdits(t, a, b, edits)
+	for _, e := range edits {
+		if e.Op == opEqual && a[e.A].Page != 3 {
+			t.Fatalf("page %d is equal, only page 3 is", a[e.A].Page)
+		}
+	}
+	if n := len(edits) - cost(edits); n != 1000 {
+		t.Errorf("%d equal tokens, want the 1000 of page 3", n)
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count int
+		want         string
+	}{
+		{0, 0, "0,0"},
+		{4, 0, "4,0"},
+		{0, 1, "1"},
+		{9, 1, "10"},
+		{9, 3, "10,3"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	d := &docDiff{OldName: "old.pdf", NewName: "new.pdf", Old: lineTokens("a b c d"), New: lineTokens("a c d e")}
+	d.Edits = diffTokens(d.Old, d.New)
+	want := "--- old.pdf\n+++ new.pdf\n" +
+		"@@ -1,4 +1,4 @@ page 1 → 1\n a\n-b\n c\n d\n+e\n"
+	if got := d.unifiedDiff(); got != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+}
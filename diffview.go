@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// DiffMsg carries the comparison of two documents.
+type DiffMsg struct {
+	Diff *docDiff
+	Err  error
+}
+
+// compareCmd diffs two documents by word in the background.
+func compareCmd(oldPath, newPath string) tea.Cmd {
+	return func() tea.Msg {
+		d, err := compareDocs(oldPath, newPath, false)
+		return DiffMsg{Diff: d, Err: err}
+	}
+}
+
+// startDiff shows the diff view while the documents are compared.
+func (m model) startDiff(oldPath, newPath string) (model, tea.Cmd) {
+	m.DiffMode = true
+	m.Diff = nil
+	m.DiffOld, m.DiffNew = oldPath, newPath
+	return m, compareCmd(oldPath, newPath)
+}
+
+// handleDiffKey compares the documents of the split view, the left pane
+// being the old version.
+func (m model) handleDiffKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode || !m.Split {
+		return m, nil
+	}
+	left, right := m.document, m.SplitDoc
+	if m.PaneFocus {
+		left, right = right, left
+	}
+	return m.startDiff(left.FileName, right.FileName)
+}
+
+func (m model) handleDiffMsg(msg DiffMsg) (tea.Model, tea.Cmd) {
+	if !m.DiffMode {
+		return m, nil
+	}
+	if msg.Err != nil {
+		m.DiffMode = false
+		return m.showError("compare", msg.Err)
+	}
+	m.Diff = msg.Diff
+	m.DiffHunk = 0
+	m.DiffView = viewport.New(screenWidth(), 0)
+	m.DiffView.Style = bodyStyle
+	m.renderDiff()
+	return m, nil
+}
+
+// renderDiff lays the diff out for the current width.
+func (m *model) renderDiff() {
+	if m.Diff == nil {
+		return
+	}
+	m.DiffView.Width = screenWidth()
+	m.DiffView.Height = max(screenHeight()-lipgloss.Height(m.diffHeaderView())-lipgloss.Height(m.diffFooterView()), 1)
+	content, starts := m.Diff.wordDiff(screenWidth())
+	if len(starts) == 0 {
+		content = mutedStyle.Render("The documents have the same text.")
+	}
+	m.DiffView.SetContent(content)
+	m.DiffHunks = starts
+	m.DiffHunk = min(m.DiffHunk, max(len(starts)-1, 0))
+}
+
+// currentHunk returns the index of the last hunk starting at or above the
+// top of the view.
+func (m model) currentHunk() int {
+	current := 0
+	for i, line := range m.DiffHunks {
+		if line <= m.DiffView.YOffset {
+			current = i
+		}
+	}
+	return current
+}
+
+// handleDiffViewKey scrolls the diff, the page keys jump between hunks.
+func (m model) handleDiffViewKey(msg tea.KeyMsg, keypress string) (tea.Model, tea.Cmd) {
+	switch {
+	case keyMatches(keypress, m.Keys.Quit):
+		// started from the command line, there is nothing to go back to
+		if msg.String() == "ctrl+c" || len(m.Tabs) == 0 {
+			return m, tea.Quit
+		}
+		m.DiffMode = false
+		m.Diff = nil
+		return m, nil
+	case keyMatches(keypress, m.Keys.Help):
+		m.ShowHelp = true
+	case m.Diff == nil:
+		// nothing to move until the documents are compared
+	case keyMatches(keypress, m.Keys.NextPage):
+		if m.DiffHunk+1 < len(m.DiffHunks) {
+			m.DiffHunk++
+			m.DiffView.SetYOffset(m.DiffHunks[m.DiffHunk])
+		}
+		return m, nil
+	case keyMatches(keypress, m.Keys.PrevPage):
+		if m.DiffHunk > 0 {
+			m.DiffHunk--
+			m.DiffView.SetYOffset(m.DiffHunks[m.DiffHunk])
+		}
+		return m, nil
+	case keyMatches(keypress, m.Keys.Up):
+		m.DiffView.LineUp(1)
+	case keyMatches(keypress, m.Keys.Down):
+		m.DiffView.LineDown(1)
+	case keyMatches(keypress, m.Keys.HalfPageUp):
+		m.DiffView.HalfViewUp()
+	case keyMatches(keypress, m.Keys.HalfPageDown):
+		m.DiffView.HalfViewDown()
+	case keyMatches(keypress, m.Keys.PageUp):
+		m.DiffView.ViewUp()
+	case keyMatches(keypress, m.Keys.PageDown):
+		m.DiffView.ViewDown()
+	case keyMatches(keypress, m.Keys.Top):
+		m.DiffView.GotoTop()
+	case keyMatches(keypress, m.Keys.Bottom):
+		m.DiffView.GotoBottom()
+	}
+	m.DiffHunk = m.currentHunk()
+	return m, nil
+}
+
+func (m model) diffFooterView() string {
+	status := "comparing…"
+	if m.Diff != nil {
+		status = "no changes"
+		if len(m.DiffHunks) > 0 {
+			status = fmt.Sprintf("change %d/%d", m.DiffHunk+1, len(m.DiffHunks))
+		}
+	}
+	info := infoStyle.Render(fmt.Sprintf("%3.f%% %s ", m.DiffView.ScrollPercent()*100, status))
+	str := m.Help.ShortHelpView(m.Keys.DiffHelp()) + " "
+	line := str + strings.Repeat(" ", max(0, screenWidth()-(lipgloss.Width(info)+lipgloss.Width(str))))
+	return lipgloss.JoinHorizontal(lipgloss.Center, line, info)
+}
+
+func (m model) diffHeaderView() string {
+	title := titleStyleViewport.Render(diffTitle(m.DiffOld, m.DiffNew))
+	line := strings.Repeat("─", max(0, screenWidth()-lipgloss.Width(title)))
+	return lipgloss.JoinHorizontal(lipgloss.Center, title, line)
+}
+
+func (m model) diffView() string {
+	if m.Diff == nil {
+		return fmt.Sprintf("%s\n\n  %s", m.diffHeaderView(), mutedStyle.Render("extracting and comparing both documents…"))
+	}
+	return fmt.Sprintf("%s\n%s\n%s", m.diffHeaderView(), m.DiffView.View(), m.diffFooterView())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ErrorMsg reports a failure to the user. The browser or the page stays
+// where it was and the error is shown in the status bar until a key is
+// pressed.
+type ErrorMsg struct {
+	// what Lumus was doing, e.g. "open directory /tmp/books"
+	Op  string
+	Err error
+}
+
+func (e ErrorMsg) Error() string {
+	// Op already names the file, drop it from path errors
+	var pathErr *fs.PathError
+	if errors.As(e.Err, &pathErr) {
+		return e.Op + ": " + pathErr.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+// reportError returns a command that delivers the error as an ErrorMsg,
+// for failures found outside of Update.
+func reportError(op string, err error) tea.Cmd {
+	return func() tea.Msg {
+		return ErrorMsg{Op: op, Err: err}
+	}
+}
+
+// showError logs the error and shows it in the status bar.
+func (m model) showError(op string, err error) (tea.Model, tea.Cmd) {
+	return m.handleErrorMsg(ErrorMsg{Op: op, Err: err})
+}
+
+func (m model) handleErrorMsg(msg ErrorMsg) (tea.Model, tea.Cmd) {
+	log.Printf("error: %s: %+v", msg.Op, msg.Err)
+	m.Failure = &msg
+	m.Loading = false
+	return m, nil
+}
+
+// statusView renders the current error on one line across the screen.
+func (m model) statusView() string {
+	if m.Failure == nil {
+		return ""
+	}
+	text := "✖ " + m.Failure.Error() + "  (any key to dismiss)"
+	return errorStyle.Copy().Width(screenWidth()).MaxHeight(1).Render(text)
+}
+
+// withStatus puts the status bar over the last line of a view.
+func (m model) withStatus(view string) string {
+	if m.Failure == nil {
+		return view
+	}
+	if lipgloss.Height(view) >= screenHeight() {
+		lines := strings.Split(view, "\n")
+		view = strings.Join(lines[:len(lines)-1], "\n")
+	}
+	return view + "\n" + m.statusView()
+}
+
+// openDebugLog sends the standard logger to debug.log in the state
+// directory. The file is truncated on start so it only holds the details of
+// the last session.
+func openDebugLog() (*os.File, error) {
+	// nothing must reach the terminal while the alt screen is on
+	log.SetOutput(io.Discard)
+	dir := stateDir()
+	if dir == "" {
+		return nil, errors.New("no state directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "debug.log"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	log.SetOutput(f)
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	log.Printf("lumus %s started", version)
+	return f, nil
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"golang.org/x/text/unicode/norm"
+)
+
+// exportPage is a page of an exported document.
+type exportPage struct {
+	Page int    `json:"page"`
+	Text string `json:"text"`
+	// extractor that read the page, empty when none could
+	Method        string  `json:"method"`
+	OCRConfidence float64 `json:"ocr_confidence,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// outlineEntry is an item of the outline of a document, Level 0 being the
+// top.
+type outlineEntry struct {
+	Title string `json:"title"`
+	Page  int    `json:"page"`
+	Level int    `json:"level"`
+}
+
+// exportDoc is a whole document read through the reader pipeline.
+type exportDoc struct {
+	Path    string         `json:"path"`
+	Title   string         `json:"title"`
+	Author  string         `json:"author,omitempty"`
+	Outline []outlineEntry `json:"outline"`
+	Pages   []exportPage   `json:"pages"`
+}
+
+// exportFormats write a document, by the name used by --format and as
+// file extension.
+var exportFormats = map[string]func(io.Writer, *exportDoc) error{
+	"md":   writeMarkdown,
+	"txt":  writeText,
+	"html": writeHTML,
+	"json": writeJSONDoc,
+}
+
+// readExportDoc reads every page of a document, without running lines and
+// normalised. progress, when not nil, is called after each page.
+func readExportDoc(path string, progress func(page, total int)) (*exportDoc, error) {
+	title, author, _, _ := readLibraryMeta(path)
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	doc := &exportDoc{Path: path, Title: title, Author: author, Outline: readOutline(path)}
+	page, total, err := extractPage(path, 1, false, 0)
+	if total == 0 {
+		if err == nil {
+			err = errors.New("no pages")
+		}
+		return nil, err
+	}
+	for n := 1; n <= total; n++ {
+		if n > 1 {
+			page, _, err = extractPage(path, n, false, 0)
+		}
+		p := exportPage{Page: n, Text: normalizeText(page.Text), Method: page.Method}
+		if page.Method == "ocr" {
+			p.OCRConfidence = page.Confidence
+		}
+		if err != nil {
+			p.Text, p.Error = "", err.Error()
+		}
+		doc.Pages = append(doc.Pages, p)
+		if progress != nil {
+			progress(n, total)
+		}
+	}
+	return doc, nil
+}
+
+// readOutline flattens the outline of a document, nil when it has none.
+func readOutline(path string) []outlineEntry {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	bookmarks, err := api.Bookmarks(f, pdfcpuConfig(path))
+	if err != nil {
+		return nil
+	}
+	var entries []outlineEntry
+	var walk func(bms []pdfcpu.Bookmark, level int)
+	walk = func(bms []pdfcpu.Bookmark, level int) {
+		for _, b := range bms {
+			entries = append(entries, outlineEntry{Title: strings.TrimSpace(b.Title), Page: b.PageFrom, Level: level})
+			walk(b.Kids, level+1)
+		}
+	}
+	walk(bookmarks, 0)
+	return entries
+}
+
+var (
+	ligatures   = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st")
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+	lineEndings = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+)
+
+// normalizeText composes the characters, splits the ligatures of PDF
+// fonts and drops trailing spaces and runs of blank lines.
+func normalizeText(s string) string {
+	s = ligatures.Replace(norm.NFC.String(lineEndings.Replace(s)))
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return strings.Trim(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"), "\n")
+}
+
+// paragraphs rebuilds the paragraphs of a page: blank lines separate them
+// and the lines of one are joined, words hyphenated across lines too.
+func paragraphs(text string) []string {
+	var paras []string
+	for _, block := range strings.Split(text, "\n\n") {
+		var b strings.Builder
+		for _, line := range strings.Split(block, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			prev := b.String()
+			last, _ := utf8.DecodeLastRuneInString(strings.TrimSuffix(prev, "-"))
+			first, _ := utf8.DecodeRuneInString(line)
+			switch {
+			case prev == "":
+			case strings.HasSuffix(prev, "-") && unicode.IsLetter(last) && unicode.IsLower(first):
+				// exam-\nple
+				b.Reset()
+				b.WriteString(strings.TrimSuffix(prev, "-"))
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		if b.Len() > 0 {
+			paras = append(paras, b.String())
+		}
+	}
+	return paras
+}
+
+// headings returns the outline entries of each page.
+func (d *exportDoc) headings() map[int][]outlineEntry {
+	byPage := make(map[int][]outlineEntry)
+	for _, e := range d.Outline {
+		byPage[e.Page] = append(byPage[e.Page], e)
+	}
+	return byPage
+}
+
+func pageAnchor(n int) string {
+	return fmt.Sprintf("page-%d", n)
+}
+
+var (
+	// & too, or text like AT&amp;T would show as an entity
+	markdownInline = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "&", "&amp;", "<", "&lt;")
+	markdownBlock  = regexp.MustCompile(`^(#|>|[-+=]|\d+[.)])`)
+)
+
+func escapeMarkdown(s string) string {
+	s = markdownInline.Replace(s)
+	return markdownBlock.ReplaceAllString(s, `\$1`)
+}
+
+// writeMarkdown writes the title, the outline as headings and an anchor
+// at the start of every page, so that page-N links keep working.
+func writeMarkdown(w io.Writer, d *exportDoc) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", escapeMarkdown(d.Title))
+	if d.Author != "" {
+		fmt.Fprintf(&b, "\n_%s_\n", escapeMarkdown(d.Author))
+	}
+	headings := d.headings()
+	for _, p := range d.Pages {
+		fmt.Fprintf(&b, "\n<a id=\"%s\"></a>\n", pageAnchor(p.Page))
+		for _, h := range headings[p.Page] {
+			fmt.Fprintf(&b, "\n%s %s\n", strings.Repeat("#", min(h.Level+2, 6)), escapeMarkdown(h.Title))
+		}
+		for _, para := range paragraphs(p.Text) {
+			fmt.Fprintf(&b, "\n%s\n", escapeMarkdown(para))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeText writes the pages as extracted, each ended by a form feed as
+// pdftotext does.
+func writeText(w io.Writer, d *exportDoc) error {
+	var b strings.Builder
+	for _, p := range d.Pages {
+		b.WriteString(p.Text)
+		b.WriteString("\n\f")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHTML(w io.Writer, d *exportDoc) error {
+	var b strings.Builder
+	title := html.EscapeString(d.Title)
+	fmt.Fprintf(&b, "<!doctype html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n", title, title)
+	if d.Author != "" {
+		fmt.Fprintf(&b, "<p class=\"author\">%s</p>\n", html.EscapeString(d.Author))
+	}
+	headings := d.headings()
+	for _, p := range d.Pages {
+		fmt.Fprintf(&b, "<section class=\"page\" id=\"%s\">\n", pageAnchor(p.Page))
+		for _, h := range headings[p.Page] {
+			level := min(h.Level+2, 6)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", level, html.EscapeString(h.Title), level)
+		}
+		for _, para := range paragraphs(p.Text) {
+			fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(para))
+		}
+		b.WriteString("</section>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeJSONDoc(w io.Writer, d *exportDoc) error {
+	if d.Outline == nil {
+		d.Outline = []outlineEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// exportFormat picks the format of an output file by its extension.
+func exportFormat(format, out string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(out), ".")
+		if format == "markdown" {
+			format = "md"
+		}
+	}
+	if format == "" {
+		format = "txt"
+	}
+	if _, ok := exportFormats[format]; !ok {
+		return "", fmt.Errorf("unknown format %q (available: md, txt, html, json)", format)
+	}
+	return format, nil
+}
+
+// exportFile writes a document read by readExportDoc to out.
+func exportFile(d *exportDoc, format, out string) error {
+	return writeFileAtomic(out, func(w io.Writer) error {
+		return exportFormats[format](w, d)
+	})
+}
+
+// runExport exports a document:
+// lumus export book.pdf [--format md|txt|html|json] [-o out]
+// The format defaults to the extension of the output, which defaults to
+// the standard output.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "Output format: md, txt, html or json (default from the output extension, or txt)")
+	out := fs.String("o", "", "Output file (default the standard output)")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("usage: lumus export book.pdf [--format md|txt|html|json] [-o out]")
+	}
+	f, err := exportFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+	var progress func(page, total int)
+	if isTerminal(os.Stderr) {
+		progress = func(page, total int) {
+			fmt.Fprintf(os.Stderr, "\rReading page %d/%d", page, total)
+		}
+	}
+	doc, err := readExportDoc(files[0], progress)
+	if progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	if *out == "" || *out == "-" {
+		return exportFormats[f](os.Stdout, doc)
+	}
+	if err := exportFile(doc, f, *out); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d pages to %s\n", len(doc.Pages), *out)
+	return nil
+}
+
+// parseInterspersed parses the flags found before and after the
+// arguments, as in lumus export book.pdf -o book.md.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// ExportMsg reports the end of an export started from the reader.
+type ExportMsg struct {
+	Path  string
+	Pages int
+	Err   error
+}
+
+func newExportInput() textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = "book.md"
+	ti.Width = 50
+	return ti
+}
+
+// handleExportKey asks where to export the document being read, the
+// Markdown file next to it by default.
+func (m model) handleExportKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode || m.FileName == "" {
+		return m, nil
+	}
+	m.ExportMode = true
+	m.ExportInput.SetValue(strings.TrimSuffix(m.FileName, filepath.Ext(m.FileName)) + ".md")
+	m.ExportInput.CursorEnd()
+	m.ExportInput.Focus()
+	return m, textinput.Blink
+}
+
+func (m model) handleExportInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		out := expandHome(strings.TrimSpace(m.ExportInput.Value()))
+		format, err := exportFormat("", out)
+		if err != nil {
+			return m, nil
+		}
+		m.ExportMode = false
+		m.ExportInput.Blur()
+		m.Notice = "exporting…"
+		return m, exportCmd(m.FileName, format, out)
+	case "esc", "ctrl+c":
+		m.ExportMode = false
+		m.ExportInput.Blur()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.ExportInput, cmd = m.ExportInput.Update(msg)
+	return m, cmd
+}
+
+func exportCmd(path, format, out string) tea.Cmd {
+	return func() tea.Msg {
+		doc, err := readExportDoc(path, nil)
+		if err != nil {
+			return ExportMsg{Path: out, Err: err}
+		}
+		return ExportMsg{Path: out, Pages: len(doc.Pages), Err: exportFile(doc, format, out)}
+	}
+}
+
+func (m model) handleExportMsg(msg ExportMsg) (tea.Model, tea.Cmd) {
+	m.Notice = ""
+	if msg.Err != nil {
+		return m.showError("export to "+msg.Path, msg.Err)
+	}
+	cmd := m.showNotice(fmt.Sprintf("exported %d pages to %s", msg.Pages, filepath.Base(msg.Path)))
+	return m, cmd
+}
+
+func (m model) exportView() string {
+	_, err := exportFormat("", strings.TrimSpace(m.ExportInput.Value()))
+	hint := mutedStyle.Render("(md, txt, html or json by extension · enter to export, esc to cancel)")
+	if err != nil {
+		hint = matchStyle.Render(" Use a .md, .txt, .html or .json file. ")
+	}
+	s := fmt.Sprintf("Export %s to:\n%s\n\n%s", filepath.Base(m.FileName), m.ExportInput.View(), hint)
+	return helpBoxStyle.Render(s)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"trailing  \t\nspaces ", "trailing\nspaces"},
+		{"windows\r\nand\rmac", "windows\nand\nmac"},
+		{"\n\nfirst\n\n\n\n\nsecond\n\n", "first\n\nsecond"},
+		{"ﬁne ﬂow oﬃce", "fine flow office"},
+		// e and a combining acute accent
+		{"cafe\u0301", "caf\u00e9"},
+	}
+	for _, tt := range tests {
+		if got := normalizeText(tt.in); got != tt.want {
+			t.Errorf("normalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"one line", []string{"one line"}},
+		{"first line\nsecond line", []string{"first line second line"}},
+		{"one\n\ntwo", []string{"one", "two"}},
+		{"an exam-\nple of it", []string{"an example of it"}},
+		{"café-\nbar and Ré-\nécrire", []string{"cafébar and Réécrire"}},
+		// a dash that is not a hyphenation
+		{"well -\nknown", []string{"well - known"}},
+		{"self-\nService", []string{"self- Service"}},
+		{"  indented\n   lines  ", []string{"indented lines"}},
+		{"one\n\n\n\ntwo", []string{"one", "two"}},
+	}
+	for _, tt := range tests {
+		if got := paragraphs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("paragraphs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{"*bold* and _em_", `\*bold\* and \_em\_`},
+		{"[link](url)", `\[link\](url)`},
+		{"a `code` span", "a \\`code\\` span"},
+		{`back\slash`, `back\\slash`},
+		{"<b>tag</b>", "&lt;b>tag&lt;/b>"},
+		{"AT&amp;T &copy;", "AT&amp;amp;T &amp;copy;"},
+		{"# not a heading", `\# not a heading`},
+		{"> not a quote", `\> not a quote`},
+		{"- not a list", `\- not a list`},
+		{"12. not a list", `\12. not a list`},
+		{"a # in the middle", "a # in the middle"},
+	}
+	for _, tt := range tests {
+		if got := escapeMarkdown(tt.in); got != tt.want {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	d := &exportDoc{
+		Title:   "A & B",
+		Outline: []outlineEntry{{Title: "Chapter 1", Page: 2, Level: 0}},
+		Pages: []exportPage{
+			{Page: 1, Text: "Intro"},
+			{Page: 2, Text: "Some hyphen-\nated text\n\nNext"},
+		},
+	}
+	var b strings.Builder
+	if err := writeMarkdown(&b, d); err != nil {
+		t.Fatal(err)
+	}
+	want := "# A &amp; B\n" +
+		"\n<a id=\"page-1\"></a>\n\nIntro\n" +
+		"\n<a id=\"page-2\"></a>\n\n## Chapter 1\n\nSome hyphenated text\n\nNext\n"
+	if got := b.String(); got != want {
+		t.Errorf("writeMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
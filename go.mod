@@ -4,6 +4,7 @@ go 1.21
 
 require (
 	code.sajari.com/docconv/v2 v2.0.0-pre.4
+	github.com/BurntSushi/toml v1.4.0
 	github.com/charmbracelet/bubbles v0.18.0
 	github.com/charmbracelet/bubbletea v0.25.0
 	github.com/charmbracelet/lipgloss v0.10.0
@@ -12,6 +13,7 @@ require (
 	github.com/mattn/go-runewidth v0.0.15
 	github.com/otiai10/gosseract/v2 v2.4.1
 	github.com/pdfcpu/pdfcpu v0.7.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -53,7 +55,6 @@ require (
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/term v0.18.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// number of lines at the top and at the bottom of a page that are
+// candidates for running headers, footers and page numbers
+const edgeLines = 3
+
+// runningLineKey normalises a line so that "Chapter 3 — Rust  12" and
+// "Chapter 3 — Rust 13" compare equal: case and spaces are ignored and
+// every run of digits becomes a single '#'.
+func runningLineKey(line string) string {
+	var b strings.Builder
+	inDigits := false
+	for _, r := range line {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case unicode.IsDigit(r):
+			if !inDigits {
+				b.WriteByte('#')
+			}
+			inDigits = true
+			continue
+		}
+		inDigits = false
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// pageLines returns the text of a page row by row, as read by the
+// ledongthuc reader. It is much cheaper than docconv but loses the layout
+// of columns and tables.
+func pageLines(r *pdf.Reader, pageNum int) (lines []string) {
+	// the pdf reader panics on some malformed pages
+	defer func() {
+		if recover() != nil {
+			lines = nil
+		}
+	}()
+	if pageNum < 1 || pageNum > r.NumPage() {
+		return nil
+	}
+	p := r.Page(pageNum)
+	if p.V.IsNull() {
+		return nil
+	}
+	rows, err := p.GetTextByRow()
+	if err != nil {
+		return nil
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for _, t := range row.Content {
+			b.WriteString(t.S)
+		}
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+// pageEdgeKeys returns the keys of the first and last lines of a page,
+// good enough to compare the edges of neighbouring pages.
+func pageEdgeKeys(r *pdf.Reader, pageNum int) map[string]bool {
+	keys := make(map[string]bool)
+	var lines []string
+	for _, line := range pageLines(r, pageNum) {
+		if key := runningLineKey(line); key != "" {
+			lines = append(lines, key)
+		}
+	}
+	for i, key := range lines {
+		if i < edgeLines || i >= len(lines)-edgeLines {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// stripRunningLines removes the lines at the top and bottom of the page
+// text that also appear, with digit variations, at the edges of the
+// previous or next page.
+func stripRunningLines(text string, r *pdf.Reader, pageNum int) string {
+	neighbours := pageEdgeKeys(r, pageNum-1)
+	for key := range pageEdgeKeys(r, pageNum+1) {
+		neighbours[key] = true
+	}
+	return stripEdgeLines(text, neighbours)
+}
+
+// stripEdgeLines removes the lines at the top and bottom of text whose
+// keys are in neighbours.
+func stripEdgeLines(text string, neighbours map[string]bool) string {
+	if len(neighbours) == 0 {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	isRunning := func(line string) bool {
+		key := runningLineKey(line)
+		return key != "" && neighbours[key]
+	}
+
+	// walk in from each edge, skipping blank lines, and stop at the
+	// first line that does not repeat on a neighbouring page
+	start, seen := 0, 0
+	for start < len(lines) && seen < edgeLines {
+		if strings.TrimSpace(lines[start]) == "" {
+			start++
+			continue
+		}
+		if !isRunning(lines[start]) {
+			break
+		}
+		start++
+		seen++
+	}
+	end, seen := len(lines), 0
+	for end > start && seen < edgeLines {
+		if strings.TrimSpace(lines[end-1]) == "" {
+			end--
+			continue
+		}
+		if !isRunning(lines[end-1]) {
+			break
+		}
+		end--
+		seen++
+	}
+	return strings.Join(lines[start:end], "\n")
+}
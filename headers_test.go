@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestPDF writes a PDF with a line of Helvetica text for each string
+// of each page.
+func writeTestPDF(t *testing.T, pages [][]string) string {
+	t.Helper()
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var kids []string
+	for i, lines := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+		objs = append(objs, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+		var body strings.Builder
+		for j, l := range lines {
+			fmt.Fprintf(&body, "BT /F1 12 Tf 1 0 0 1 72 %d Tm (%s) Tj ET\n", 720-14*j, l)
+		}
+		objs = append(objs, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", body.Len(), body.String()))
+	}
+	objs[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	var offsets []int
+	for i, o := range objs {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	path := filepath.Join(t.TempDir(), "test.pdf")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunningLineKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"Chapter 3 — Rust  12", "chapter#—rust#"},
+		{"Chapter 3 — Rust 13", "chapter#—rust#"},
+		{"Page 1 of 200", "page#of#"},
+		{"  THE   Title ", "thetitle"},
+		{"42", "#"},
+		{"1 2 3", "#"},
+		{"١٢٣ arabic digits", "#arabicdigits"},
+	}
+	for _, tt := range tests {
+		if got := runningLineKey(tt.in); got != tt.want {
+			t.Errorf("runningLineKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStripEdgeLines(t *testing.T) {
+	neighbours := map[string]bool{
+		runningLineKey("The Book"):   true,
+		runningLineKey("Chapter 1"):  true,
+		runningLineKey("Page 7"):     true,
+		runningLineKey("Body again"): true,
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{"none", "first\nsecond", "first\nsecond"},
+		{"header", "The Book\nfirst\nsecond", "first\nsecond"},
+		{"footer with another number", "first\nsecond\nPage 8", "first\nsecond"},
+		{"both and blank lines", "\nThe Book\n\nChapter 2\nfirst\n\nPage 12\n", "first"},
+		{"stops at the first body line", "first\nThe Book\nsecond", "first\nThe Book\nsecond"},
+		{"at most edgeLines", "The Book\nChapter 1\nPage 1\nBody again\nfirst", "Body again\nfirst"},
+		{"everything", "The Book\nPage 3", ""},
+	}
+	for _, tt := range tests {
+		if got := stripEdgeLines(tt.in, neighbours); got != tt.want {
+			t.Errorf("%s: stripEdgeLines(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+	if got := stripEdgeLines("The Book\nfirst", nil); got != "The Book\nfirst" {
+		t.Errorf("without neighbours: got %q", got)
+	}
+}
+
+func TestStripRunningLines(t *testing.T) {
+	var pages [][]string
+	for p := 1; p <= 3; p++ {
+		pages = append(pages, []string{"A Short Book", fmt.Sprintf("Text of page %c", 'A'+p-1), fmt.Sprintf("More text of %c", 'A'+p-1), fmt.Sprintf("- %d -", p)})
+	}
+	f, r, err := openPDF(writeTestPDF(t, pages))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for p := 1; p <= 3; p++ {
+		text := strings.Join(pageLines(r, p), "\n")
+		want := fmt.Sprintf("Text of page %c\nMore text of %c", 'A'+p-1, 'A'+p-1)
+		if got := stripRunningLines(text, r, p); got != want {
+			t.Errorf("page %d: stripRunningLines() = %q, want %q", p, got, want)
+		}
+	}
+}
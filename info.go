@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// docInfo is everything pdfcpu knows about a document that helps to tell
+// why its text extracts badly.
+type docInfo struct {
+	File             string     `json:"file"`
+	Title            string     `json:"title"`
+	Author           string     `json:"author"`
+	Subject          string     `json:"subject"`
+	Keywords         []string   `json:"keywords"`
+	Creator          string     `json:"creator"`
+	Producer         string     `json:"producer"`
+	CreationDate     string     `json:"creation_date"`
+	ModificationDate string     `json:"modification_date"`
+	Version          string     `json:"version"`
+	Pages            int        `json:"pages"`
+	PageSizes        []string   `json:"page_sizes"`
+	Encrypted        bool       `json:"encrypted"`
+	Permissions      []string   `json:"permissions"`
+	Tagged           bool       `json:"tagged"`
+	Fonts            []fontInfo `json:"fonts"`
+	// pages with fonts, with images but no fonts, and with neither
+	TextPages      int   `json:"text_pages"`
+	ImageOnlyPages []int `json:"image_only_pages"`
+	EmptyPages     []int `json:"empty_pages"`
+	// hints about what to expect from the extraction
+	Notes []string `json:"notes"`
+}
+
+type fontInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Embedded bool   `json:"embedded"`
+}
+
+// DocInfoMsg carries the properties read in the background for the i key.
+type DocInfoMsg struct {
+	Info docInfo
+	Err  error
+}
+
+func readDocInfo(path string) (docInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return docInfo{}, err
+	}
+	defer f.Close()
+
+	pdfConf := pdfcpuConfig(path)
+	pdfConf.ValidationMode = pdfmodel.ValidationRelaxed
+	pdfConf.Cmd = pdfmodel.LISTINFO
+	// fonts and images per page need an optimized context
+	ctx, err := api.ReadValidateAndOptimize(f, pdfConf)
+	if err != nil {
+		return docInfo{}, passwordError(pdfConf.UserPW, err)
+	}
+	pages, err := api.PagesForPageSelection(ctx.PageCount, nil, false, false)
+	if err != nil {
+		return docInfo{}, err
+	}
+	pi, err := pdfcpu.Info(ctx, filepath.Base(path), pages)
+	if err != nil {
+		return docInfo{}, err
+	}
+
+	info := docInfo{
+		File:             path,
+		Title:            pi.Title,
+		Author:           pi.Author,
+		Subject:          pi.Subject,
+		Keywords:         pi.Keywords,
+		Creator:          pi.Creator,
+		Producer:         pi.Producer,
+		CreationDate:     pi.CreationDate,
+		ModificationDate: pi.ModificationDate,
+		Version:          pi.Version,
+		Pages:            pi.PageCount,
+		Encrypted:        pi.Encrypted,
+		Permissions:      pdfcpu.Permissions(ctx),
+		Tagged:           pi.Tagged,
+	}
+	for d := range pi.PageDimensions {
+		info.PageSizes = append(info.PageSizes, fmt.Sprintf("%.0f × %.0f pt", d.Width, d.Height))
+	}
+	sort.Strings(info.PageSizes)
+
+	for _, fo := range ctx.Optimize.FontObjects {
+		info.Fonts = append(info.Fonts, fontInfo{Name: fo.FontName, Type: fo.SubType(), Embedded: fo.Embedded()})
+	}
+	sort.Slice(info.Fonts, func(i, j int) bool { return info.Fonts[i].Name < info.Fonts[j].Name })
+
+	for p := 1; p <= ctx.PageCount; p++ {
+		switch {
+		case len(pdfcpu.FontObjNrs(ctx, p)) > 0:
+			info.TextPages++
+		case len(pdfcpu.ImageObjNrs(ctx, p)) > 0:
+			info.ImageOnlyPages = append(info.ImageOnlyPages, p)
+		default:
+			info.EmptyPages = append(info.EmptyPages, p)
+		}
+	}
+	info.Notes = info.notes()
+	return info, nil
+}
+
+func (info docInfo) notes() []string {
+	var notes []string
+	if n := len(info.ImageOnlyPages); n > 0 {
+		if n == info.Pages {
+			notes = append(notes, "Every page is an image, the text can only come from OCR.")
+		} else {
+			notes = append(notes, fmt.Sprintf("%d pages are images only (%s), their text comes from OCR.", n, pageRanges(info.ImageOnlyPages)))
+		}
+	}
+	notEmbedded := 0
+	for _, f := range info.Fonts {
+		if !f.Embedded {
+			notEmbedded++
+		}
+	}
+	if notEmbedded > 0 {
+		notes = append(notes, fmt.Sprintf("%d fonts are not embedded, characters may be missing or wrong.", notEmbedded))
+	}
+	if info.Encrypted {
+		notes = append(notes, "The document is encrypted.")
+	}
+	if !info.Tagged && info.TextPages > 0 {
+		notes = append(notes, "The document is not tagged, reading order is guessed from the layout.")
+	}
+	return notes
+}
+
+// pageRanges formats sorted page numbers as "1-3, 7".
+func pageRanges(pages []int) string {
+	var ranges []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(pages[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// fields returns the label and value of every property, in display order.
+func (info docInfo) fields() [][2]string {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	fields := [][2]string{
+		{"File", info.File},
+		{"Title", info.Title},
+		{"Author", info.Author},
+		{"Subject", info.Subject},
+		{"Keywords", strings.Join(info.Keywords, ", ")},
+		{"Creator", info.Creator},
+		{"Producer", info.Producer},
+		{"Created", info.CreationDate},
+		{"Modified", info.ModificationDate},
+		{"PDF version", info.Version},
+		{"Pages", fmt.Sprint(info.Pages)},
+		{"Page sizes", strings.Join(info.PageSizes, ", ")},
+		{"Encrypted", yesNo(info.Encrypted)},
+		{"Permissions", strings.Join(info.Permissions, ", ")},
+		{"Tagged", yesNo(info.Tagged)},
+		{"Text pages", fmt.Sprint(info.TextPages)},
+		{"Image only", pageRanges(info.ImageOnlyPages)},
+		{"Empty pages", pageRanges(info.EmptyPages)},
+	}
+	for i, f := range info.Fonts {
+		label := ""
+		if i == 0 {
+			label = "Fonts"
+		}
+		value := f.Name + " (" + f.Type
+		if !f.Embedded {
+			value += ", not embedded"
+		}
+		fields = append(fields, [2]string{label, value + ")"})
+	}
+	for i, note := range info.Notes {
+		label := ""
+		if i == 0 {
+			label = "Notes"
+		}
+		fields = append(fields, [2]string{label, note})
+	}
+	return fields
+}
+
+// String formats the properties for the terminal, one per line.
+func (info docInfo) String() string {
+	var b strings.Builder
+	for _, f := range info.fields() {
+		fmt.Fprintf(&b, "%12s  %s\n", f[0], f[1])
+	}
+	return b.String()
+}
+
+func (m model) handleInfoKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode {
+		return m, nil
+	}
+	m.ShowInfo = true
+	m.Info = nil
+	path := m.FileName
+	return m, func() tea.Msg {
+		info, err := readDocInfo(path)
+		return DocInfoMsg{Info: info, Err: err}
+	}
+}
+
+func (m model) handleDocInfoMsg(msg DocInfoMsg) (tea.Model, tea.Cmd) {
+	m.Info = &msg
+	return m, nil
+}
+
+func (m model) infoView() string {
+	var b strings.Builder
+	switch {
+	case m.Info == nil:
+		b.WriteString(mutedStyle.Render("Reading document properties…"))
+	case m.Info.Err != nil:
+		b.WriteString("Cannot read the document properties: " + m.Info.Err.Error())
+	default:
+		// keep the box inside the screen, fonts can be many
+		fields := m.Info.Info.fields()
+		if limit := screenHeight() - 6; len(fields) > limit && limit > 0 {
+			fields = append(fields[:limit-1], [2]string{"", fmt.Sprintf("… %d more", len(fields)-limit+1)})
+		}
+		valueStyle := lipgloss.NewStyle().MaxWidth(screenWidth() - 24)
+		for _, f := range fields {
+			b.WriteString(mutedStyle.Render(fmt.Sprintf("%12s  ", f[0])) + valueStyle.Render(textStyle(f[1])) + "\n")
+		}
+	}
+	box := helpBoxStyle.Render(strings.TrimRight(b.String(), "\n"))
+	return lipgloss.Place(screenWidth(), screenHeight(), lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+type keyMap struct {
+	Up            key.Binding
+	Down          key.Binding
+	HalfPageUp    key.Binding
+	HalfPageDown  key.Binding
+	PageUp        key.Binding
+	PageDown      key.Binding
+	Top           key.Binding
+	Bottom        key.Binding
+	NextPage      key.Binding
+	PrevPage      key.Binding
+	GoToPage      key.Binding
+	Open          key.Binding
+	Back          key.Binding
+	ToggleHeaders key.Binding
+	Continuous    key.Binding
+	Theme         key.Binding
+	Sort          key.Binding
+	Hidden        key.Binding
+	Library       key.Binding
+	Search        key.Binding
+	Switcher      key.Binding
+	Split         key.Binding
+	SwitchPane    key.Binding
+	SyncScroll    key.Binding
+	Diff          key.Binding
+	InverseSearch key.Binding
+	Export        key.Binding
+	NextTab       key.Binding
+	PrevTab       key.Binding
+	Preview       key.Binding
+	Info          key.Binding
+	Help          key.Binding
+	Quit          key.Binding
+}
+
+// newBinding creates a binding whose help shows all of its keys. Keys
+// separated by a space are sequences, such as "g g".
+func newBinding(desc string, keys ...string) key.Binding {
+	b := key.NewBinding(key.WithKeys(keys...))
+	setBindingKeys(&b, desc, keys)
+	return b
+}
+
+func setBindingKeys(b *key.Binding, desc string, keys []string) {
+	b.SetKeys(keys...)
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		if k == " " {
+			names[i] = "space"
+			continue
+		}
+		names[i] = strings.ReplaceAll(k, " ", "")
+	}
+	b.SetHelp(strings.Join(names, "/"), desc)
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Up:            newBinding("scroll up", "up", "w"),
+		Down:          newBinding("scroll down", "down", "s"),
+		HalfPageUp:    newBinding("half page up", "ctrl+u"),
+		HalfPageDown:  newBinding("half page down", "ctrl+d"),
+		PageUp:        newBinding("screen up", "pgup"),
+		PageDown:      newBinding("screen down", "pgdown"),
+		Top:           newBinding("go to top", "home"),
+		Bottom:        newBinding("go to bottom", "end"),
+		NextPage:      newBinding("next page", "right", "d"),
+		PrevPage:      newBinding("previous page", "left", "a"),
+		GoToPage:      newBinding("go to page", "p"),
+		Open:          newBinding("open", "enter"),
+		Back:          newBinding("parent directory/browser", "backspace"),
+		ToggleHeaders: newBinding("toggle headers", "h"),
+		Continuous:    newBinding("continuous scroll", "c"),
+		Theme:         newBinding("next theme", "t"),
+		Sort:          newBinding("sort files", "o"),
+		Hidden:        newBinding("hidden files", "."),
+		Library:       newBinding("library", "L"),
+		Search:        newBinding("search library", "S"),
+		Switcher:      newBinding("recent documents", "ctrl+o"),
+		Split:         newBinding("split view", "|"),
+		SwitchPane:    newBinding("other pane", "ctrl+w"),
+		SyncScroll:    newBinding("sync scroll", "="),
+		Diff:          newBinding("compare panes", "D"),
+		InverseSearch: newBinding("edit source", "E"),
+		Export:        newBinding("export document", "X"),
+		NextTab:       newBinding("next tab", "tab"),
+		PrevTab:       newBinding("previous tab", "shift+tab"),
+		Preview:       newBinding("toggle preview", "v"),
+		Info:          newBinding("document properties", "i"),
+		Help:          newBinding("help", "?"),
+		Quit:          newBinding("back/quit", "ctrl+c", "ctrl+q", "q", "esc"),
+	}
+}
+
+func vimKeyMap() keyMap {
+	k := defaultKeyMap()
+	k.Up = newBinding("scroll up", "k", "up")
+	k.Down = newBinding("scroll down", "j", "down")
+	k.PageUp = newBinding("screen up", "ctrl+b", "pgup")
+	k.PageDown = newBinding("screen down", "ctrl+f", "pgdown")
+	k.Top = newBinding("go to top", "g g", "home")
+	k.Bottom = newBinding("go to bottom", "G", "end")
+	k.NextPage = newBinding("next page", "l", "right")
+	k.PrevPage = newBinding("previous page", "h", "left")
+	k.GoToPage = newBinding("go to page", ":", "p")
+	k.ToggleHeaders = newBinding("toggle headers", "H")
+	k.NextTab = newBinding("next tab", "g t", "tab")
+	k.PrevTab = newBinding("previous tab", "g T", "shift+tab")
+	return k
+}
+
+func lessKeyMap() keyMap {
+	k := defaultKeyMap()
+	k.Up = newBinding("scroll up", "k", "y", "up")
+	k.Down = newBinding("scroll down", "j", "e", "down")
+	k.HalfPageUp = newBinding("half page up", "u", "ctrl+u")
+	k.HalfPageDown = newBinding("half page down", "d", "ctrl+d")
+	k.PageUp = newBinding("screen up", "b", "pgup")
+	k.PageDown = newBinding("screen down", " ", "f", "pgdown")
+	k.Top = newBinding("go to top", "g", "<", "home")
+	k.Bottom = newBinding("go to bottom", "G", ">", "end")
+	k.NextPage = newBinding("next page", "n", "right")
+	k.PrevPage = newBinding("previous page", "N", "left")
+	k.ToggleHeaders = newBinding("toggle headers", "H")
+	k.Help = newBinding("help", "?", "h")
+	return k
+}
+
+var keyMapPresets = map[string]func() keyMap{
+	"default": defaultKeyMap,
+	"vim":     vimKeyMap,
+	"less":    lessKeyMap,
+}
+
+// bindings maps the names used in the config file to the bindings.
+func (k *keyMap) bindings() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"up":             &k.Up,
+		"down":           &k.Down,
+		"half_page_up":   &k.HalfPageUp,
+		"half_page_down": &k.HalfPageDown,
+		"page_up":        &k.PageUp,
+		"page_down":      &k.PageDown,
+		"top":            &k.Top,
+		"bottom":         &k.Bottom,
+		"next_page":      &k.NextPage,
+		"prev_page":      &k.PrevPage,
+		"go_to_page":     &k.GoToPage,
+		"open":           &k.Open,
+		"back":           &k.Back,
+		"toggle_headers": &k.ToggleHeaders,
+		"continuous":     &k.Continuous,
+		"cycle_theme":    &k.Theme,
+		"cycle_sort":     &k.Sort,
+		"toggle_hidden":  &k.Hidden,
+		"library":        &k.Library,
+		"search":         &k.Search,
+		"switcher":       &k.Switcher,
+		"split":          &k.Split,
+		"switch_pane":    &k.SwitchPane,
+		"sync_scroll":    &k.SyncScroll,
+		"diff":           &k.Diff,
+		"inverse_search": &k.InverseSearch,
+		"export":         &k.Export,
+		"next_tab":       &k.NextTab,
+		"prev_tab":       &k.PrevTab,
+		"toggle_preview": &k.Preview,
+		"show_info":      &k.Info,
+		"help":           &k.Help,
+		"quit":           &k.Quit,
+	}
+}
+
+// newKeyMap builds the preset and applies the user overrides on top of it.
+func newKeyMap(preset string, overrides map[string][]string) (keyMap, error) {
+	if preset == "" {
+		preset = "default"
+	}
+	newPreset, ok := keyMapPresets[preset]
+	if !ok {
+		return keyMap{}, fmt.Errorf("unknown keymap preset %q (available: %s)", preset, strings.Join(keyMapPresetNames(), ", "))
+	}
+	k := newPreset()
+	bindings := k.bindings()
+	for name, keys := range overrides {
+		b, ok := bindings[name]
+		if !ok {
+			return keyMap{}, fmt.Errorf("unknown key binding %q", name)
+		}
+		if len(keys) == 0 {
+			b.Unbind()
+			continue
+		}
+		setBindingKeys(b, b.Help().Desc, keys)
+	}
+	return k, nil
+}
+
+// keyMatches reports whether the keypress, or key sequence, triggers b.
+func keyMatches(keypress string, b key.Binding) bool {
+	if !b.Enabled() {
+		return false
+	}
+	for _, k := range b.Keys() {
+		if k == keypress {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrefix reports whether keypress starts a key sequence.
+func (k *keyMap) isPrefix(keypress string) bool {
+	for _, b := range k.bindings() {
+		if !b.Enabled() {
+			continue
+		}
+		for _, seq := range b.Keys() {
+			if strings.HasPrefix(seq, keypress+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.GoToPage, k.NextPage, k.PrevPage, k.Help}
+}
+
+// DiffHelp is the short help of the diff view, where the page keys jump
+// between the changes.
+func (k keyMap) DiffHelp() []key.Binding {
+	next, prev := k.NextPage, k.PrevPage
+	next.SetHelp(next.Help().Key, "next change")
+	prev.SetHelp(prev.Help().Key, "previous change")
+	return []key.Binding{next, prev, k.Quit}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.HalfPageUp, k.HalfPageDown, k.PageUp, k.PageDown},
+		{k.Top, k.Bottom, k.NextPage, k.PrevPage, k.GoToPage},
+		{k.Open, k.Back, k.Sort, k.Hidden, k.Library, k.Search, k.Switcher, k.Preview, k.Info},
+		{k.NextTab, k.PrevTab, k.Split, k.SwitchPane, k.SyncScroll, k.Diff, k.InverseSearch, k.Export, k.ToggleHeaders, k.Continuous, k.Theme, k.Help, k.Quit},
+	}
+}
+
+func keyMapPresetNames() []string {
+	names := make([]string, 0, len(keyMapPresets))
+	for name := range keyMapPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// libraryDoc is a document found under one of the library roots.
+type libraryDoc struct {
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Title   string    `json:"title"`
+	Author  string    `json:"author"`
+	// from the Keywords of the document
+	Tags  []string  `json:"tags"`
+	Pages int       `json:"pages"`
+	Added time.Time `json:"added"`
+}
+
+// displayTitle falls back to the file name for untitled documents.
+func (d libraryDoc) displayTitle() string {
+	if d.Title != "" {
+		return d.Title
+	}
+	return strings.TrimSuffix(filepath.Base(d.Path), filepath.Ext(d.Path))
+}
+
+// library is the set of registered roots and the documents found under
+// them, by absolute path. It is saved as JSON in the data directory.
+type library struct {
+	mu    sync.Mutex
+	path  string
+	Roots []string              `json:"roots"`
+	Docs  map[string]libraryDoc `json:"docs"`
+}
+
+// scanStats counts what a scan changed.
+type scanStats struct {
+	Added, Updated, Moved, Removed int
+}
+
+func (s scanStats) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d moved, %d removed", s.Added, s.Updated, s.Moved, s.Removed)
+}
+
+var lib = loadLibrary(libraryPath())
+
+// dataDir returns $XDG_DATA_HOME/lumus, falling back to ~/.local/share
+// when XDG_DATA_HOME is not set.
+func dataDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "lumus")
+}
+
+func libraryPath() string {
+	dir := dataDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "library.json")
+}
+
+// loadLibrary reads the library file, a missing file is an empty library.
+func loadLibrary(path string) *library {
+	l := &library{path: path, Docs: make(map[string]libraryDoc)}
+	if path == "" {
+		return l
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l
+	}
+	if err := json.Unmarshal(data, l); err != nil || l.Docs == nil {
+		l.Docs = make(map[string]libraryDoc)
+	}
+	return l
+}
+
+// save writes the library, the caller holds the lock.
+func (l *library) save() error {
+	if l.path == "" {
+		return errors.New("no data directory")
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return writeFileAtomic(l.path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// addRoot registers a directory, its documents are found by the next scan.
+func (l *library) addRoot(dir string) error {
+	dir, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, root := range l.Roots {
+		if root == dir {
+			return nil
+		}
+	}
+	l.Roots = append(l.Roots, dir)
+	sort.Strings(l.Roots)
+	return l.save()
+}
+
+// removeRoot forgets a directory, its documents go with the next scan.
+func (l *library) removeRoot(dir string) error {
+	dir, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, root := range l.Roots {
+		if root == dir {
+			l.Roots = append(l.Roots[:i], l.Roots[i+1:]...)
+			return l.save()
+		}
+	}
+	return fmt.Errorf("%s is not a library root", dir)
+}
+
+func (l *library) roots() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.Roots...)
+}
+
+// docs returns a copy of the documents, safe to use while a scan runs.
+func (l *library) docs() []libraryDoc {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	docs := make([]libraryDoc, 0, len(l.Docs))
+	for _, d := range l.Docs {
+		docs = append(docs, d)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Path < docs[j].Path })
+	return docs
+}
+
+// scanned is a PDF found by the walk whose content may have changed.
+type scanned struct {
+	Path string
+	Info fs.FileInfo
+	Hash string
+}
+
+// scan walks the roots and brings the documents up to date. Files whose
+// size and modification time did not change are not read again. A new
+// path with the hash of a document that disappeared is a move, it keeps
+// the date the document was added.
+func (l *library) scan() (scanStats, error) {
+	var stats scanStats
+	known := make(map[string]libraryDoc)
+	for _, d := range l.docs() {
+		known[d.Path] = d
+	}
+
+	seen := make(map[string]bool)
+	var changed []scanned
+	var walkErrs []error
+	for _, root := range l.roots() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// an unreadable directory does not stop the scan
+				walkErrs = append(walkErrs, err)
+				return nil
+			}
+			if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".pdf") {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				walkErrs = append(walkErrs, err)
+				return nil
+			}
+			seen[path] = true
+			if old, ok := known[path]; ok && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+				return nil
+			}
+			hash, err := fileHash(path)
+			if err != nil {
+				walkErrs = append(walkErrs, err)
+				return nil
+			}
+			changed = append(changed, scanned{Path: path, Info: info, Hash: hash})
+			return nil
+		})
+		if err != nil {
+			walkErrs = append(walkErrs, err)
+		}
+	}
+
+	// documents that disappeared, by hash, candidates for a move
+	gone := make(map[string]libraryDoc)
+	for path, d := range known {
+		if !seen[path] {
+			gone[d.Hash] = d
+		}
+	}
+
+	docs := make(map[string]libraryDoc, len(seen))
+	for path := range seen {
+		if d, ok := known[path]; ok {
+			docs[path] = d
+		}
+	}
+	for _, s := range changed {
+		doc := libraryDoc{Path: s.Path, Hash: s.Hash, Size: s.Info.Size(), ModTime: s.Info.ModTime(), Added: time.Now()}
+		old, ok := known[s.Path]
+		moved, wasMoved := gone[s.Hash]
+		switch {
+		case ok:
+			doc.Added = old.Added
+			stats.Updated++
+		case wasMoved:
+			doc.Added = moved.Added
+			delete(gone, s.Hash)
+			stats.Moved++
+		default:
+			stats.Added++
+		}
+		if ok && old.Hash == s.Hash {
+			// touched but not changed, the metadata still holds
+			doc.Title, doc.Author, doc.Tags, doc.Pages = old.Title, old.Author, old.Tags, old.Pages
+		} else if wasMoved {
+			doc.Title, doc.Author, doc.Tags, doc.Pages = moved.Title, moved.Author, moved.Tags, moved.Pages
+		} else {
+			doc.Title, doc.Author, doc.Tags, doc.Pages = readLibraryMeta(s.Path)
+		}
+		docs[s.Path] = doc
+	}
+	stats.Removed = len(gone)
+
+	l.mu.Lock()
+	l.Docs = docs
+	err := l.save()
+	l.mu.Unlock()
+	if err != nil {
+		return stats, err
+	}
+	return stats, errors.Join(walkErrs...)
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readLibraryMeta reads the title, author, keywords and page count of a
+// PDF. Encrypted documents without a known password keep empty metadata.
+func readLibraryMeta(path string) (title, author string, tags []string, pages int) {
+	// the pdf reader panics on some malformed files
+	defer func() {
+		if recover() != nil {
+			title, author, tags, pages = "", "", nil, 0
+		}
+	}()
+	f, r, err := openPDF(path)
+	if err != nil {
+		return "", "", nil, 0
+	}
+	defer f.Close()
+	info := r.Trailer().Key("Info")
+	keywords := info.Key("Keywords").Text()
+	for _, tag := range strings.FieldsFunc(keywords, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return strings.TrimSpace(info.Key("Title").Text()), strings.TrimSpace(info.Key("Author").Text()), tags, r.NumPage()
+}
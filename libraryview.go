@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// libraryGrouping is how the library view orders the documents.
+type libraryGrouping int
+
+const (
+	byTitle libraryGrouping = iota
+	byAuthor
+	byTag
+	byRecentlyAdded
+	byReading
+)
+
+func (g libraryGrouping) String() string {
+	return [...]string{"title", "author", "tag", "recently added", "currently reading"}[g]
+}
+
+func (g libraryGrouping) next() libraryGrouping {
+	return (g + 1) % (byReading + 1)
+}
+
+// libraryItem is a document of the library view. Group is the author or
+// the tag it is listed under, a document with several tags is listed once
+// per tag.
+type libraryItem struct {
+	Doc   libraryDoc
+	Group string
+}
+
+func (i libraryItem) FilterValue() string {
+	return strings.Join(append([]string{i.Doc.displayTitle(), i.Doc.Author, i.Group}, i.Doc.Tags...), " ")
+}
+
+type libraryDelegate struct{}
+
+func (d libraryDelegate) Height() int                             { return 1 }
+func (d libraryDelegate) Spacing() int                            { return 0 }
+func (d libraryDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d libraryDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	i, ok := listItem.(libraryItem)
+	if !ok {
+		return
+	}
+	group := ""
+	if i.Group != "" {
+		group = runewidth.FillRight(runewidth.Truncate(i.Group, 20, "…"), 20) + "  "
+	}
+	progress := ""
+	if s, ok := history.get(i.Doc.Path); ok {
+		progress = s.progress()
+	}
+	details := fmt.Sprintf("  %20s  %5d p  %4s", runewidth.Truncate(i.Doc.Author, 20, "…"), i.Doc.Pages, progress)
+	nameWidth := m.Width() - 6 - runewidth.StringWidth(group) - runewidth.StringWidth(details)
+	if nameWidth < 10 {
+		details = ""
+		nameWidth = m.Width() - 6 - runewidth.StringWidth(group)
+	}
+	str := group + runewidth.FillRight(runewidth.Truncate(i.Doc.displayTitle(), nameWidth, "…"), nameWidth) + details
+
+	fn := itemStyle.Render
+	if index == m.Index() {
+		fn = func(s ...string) string {
+			return selectedItemStyle.Render("→ " + strings.Join(s, " "))
+		}
+	}
+	fmt.Fprint(w, fn(str))
+}
+
+// libraryItems lists the documents for a grouping.
+func libraryItems(docs []libraryDoc, g libraryGrouping) []list.Item {
+	var items []libraryItem
+	for _, d := range docs {
+		switch g {
+		case byAuthor:
+			author := d.Author
+			if author == "" {
+				author = "(unknown)"
+			}
+			items = append(items, libraryItem{Doc: d, Group: author})
+		case byTag:
+			if len(d.Tags) == 0 {
+				items = append(items, libraryItem{Doc: d, Group: "(untagged)"})
+			}
+			for _, tag := range d.Tags {
+				items = append(items, libraryItem{Doc: d, Group: tag})
+			}
+		case byReading:
+			if s, ok := history.get(d.Path); ok && s.Page < s.TotalPages {
+				items = append(items, libraryItem{Doc: d})
+			}
+		default:
+			items = append(items, libraryItem{Doc: d})
+		}
+	}
+	title := func(i libraryItem) string { return strings.ToLower(i.Doc.displayTitle()) }
+	sort.SliceStable(items, func(a, b int) bool {
+		x, y := items[a], items[b]
+		switch g {
+		case byAuthor, byTag:
+			if gx, gy := strings.ToLower(x.Group), strings.ToLower(y.Group); gx != gy {
+				return gx < gy
+			}
+		case byRecentlyAdded:
+			if !x.Doc.Added.Equal(y.Doc.Added) {
+				return x.Doc.Added.After(y.Doc.Added)
+			}
+		case byReading:
+			sx, _ := history.get(x.Doc.Path)
+			sy, _ := history.get(y.Doc.Path)
+			if !sx.LastRead.Equal(sy.LastRead) {
+				return sx.LastRead.After(sy.LastRead)
+			}
+		}
+		return title(x) < title(y)
+	})
+	listItems := make([]list.Item, len(items))
+	for i, it := range items {
+		listItems[i] = it
+	}
+	return listItems
+}
+
+func newLibraryList(g libraryGrouping) list.Model {
+	l := list.New(libraryItems(lib.docs(), g), libraryDelegate{}, screenWidth(), listHeight)
+	l.Title = libraryTitle(g)
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(true)
+	l.Styles.Title = titleStyle
+	l.Styles.PaginationStyle = paginationStyle
+	l.Styles.HelpStyle = helpStyle
+	return l
+}
+
+func libraryTitle(g libraryGrouping) string {
+	return "Library · by " + g.String()
+}
+
+// LibraryScanMsg reports the end of a background scan of the library.
+type LibraryScanMsg struct {
+	Stats scanStats
+	Err   error
+}
+
+// scanLibraryCmd rescans the library roots in the background.
+func scanLibraryCmd() tea.Cmd {
+	if len(lib.roots()) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		stats, err := lib.scan()
+		return LibraryScanMsg{Stats: stats, Err: err}
+	}
+}
+
+func (m model) handleLibraryScanMsg(msg LibraryScanMsg) (tea.Model, tea.Cmd) {
+	m.LibraryScanning = false
+	if msg.Err != nil {
+		m.Indexing = false
+		return m.showError("scan library", msg.Err)
+	}
+	if m.LibraryMode {
+		m.refreshLibrary()
+	}
+	m.Indexing = true
+	return m, indexLibraryCmd()
+}
+
+// refreshLibrary rebuilds the library list, keeping the filter and the
+// selected document.
+func (m *model) refreshLibrary() {
+	selected := ""
+	if i, ok := m.Library.SelectedItem().(libraryItem); ok {
+		selected = i.Doc.Path
+	}
+	m.Library.SetItems(libraryItems(lib.docs(), m.LibraryGrouping))
+	m.Library.Title = libraryTitle(m.LibraryGrouping)
+	for idx, li := range m.Library.Items() {
+		if li.(libraryItem).Doc.Path == selected {
+			m.Library.Select(idx)
+			break
+		}
+	}
+}
+
+func (m model) handleLibraryKey() (tea.Model, tea.Cmd) {
+	if m.ReadingMode {
+		return m, nil
+	}
+	m.LibraryMode = !m.LibraryMode
+	if !m.LibraryMode {
+		return m, nil
+	}
+	if len(lib.roots()) == 0 {
+		m.LibraryMode = false
+		return m.showError("open library", fmt.Errorf("no folders yet, add one with: lumus library add ~/Books"))
+	}
+	m.Library = newLibraryList(m.LibraryGrouping)
+	return m, nil
+}
+
+// handleLibraryListKey handles the keys of the library view that are not
+// shared with the browser: the list moves with its own keys.
+func (m model) handleLibraryListKey(msg tea.KeyMsg, keypress string) (tea.Model, tea.Cmd) {
+	switch {
+	case keyMatches(keypress, m.Keys.Quit):
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		m.LibraryMode = false
+		return m, nil
+	case keyMatches(keypress, m.Keys.Library):
+		return m.handleLibraryKey()
+	case keyMatches(keypress, m.Keys.Help):
+		m.ShowHelp = true
+		return m, nil
+	case keyMatches(keypress, m.Keys.Sort):
+		m.LibraryGrouping = m.LibraryGrouping.next()
+		m.refreshLibrary()
+		return m, nil
+	case keyMatches(keypress, m.Keys.Open):
+		i, ok := m.Library.SelectedItem().(libraryItem)
+		if !ok {
+			return m, nil
+		}
+		page := 1
+		if s, ok := history.get(i.Doc.Path); ok && s.Page > 0 {
+			page = s.Page
+		}
+		cmd := m.openDocument(i.Doc.Path, page)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.Library, cmd = m.Library.Update(msg)
+	return m, cmd
+}
+
+func (m model) libraryView() string {
+	view := m.Library.View()
+	if m.LibraryScanning {
+		view += "\n" + mutedStyle.Render("    scanning the library…")
+	}
+	return "\n" + view
+}
@@ -4,13 +4,15 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
@@ -25,84 +27,126 @@ import (
 	"github.com/ledongthuc/pdf"
 	"github.com/otiai10/gosseract/v2"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 )
 
 type model struct {
-	Files        []os.DirEntry
-	CurrentIdx   int
-	Content      string
+	// the file browser, its List and Dir are used directly
+	browser
+	// the document of the active tab, see tabs.go
+	document
+	Tabs      []document
+	ActiveTab int
+	tabSeq    int
+	// the reloaded notice last shown, see watch.go
+	noticeSeq int
+	// second pane of the split view, see split.go
+	Split        bool
+	SplitDoc     document
+	PaneFocus    bool
+	SyncScroll   bool
 	Loading      bool
-	CurrentPage  int
-	TotalPages   int
 	ReadingMode  bool
 	GoToPageMode bool
-	Viewport     viewport.Model
-	List         list.Model
-	FileName     string
 	TextInput    textinput.Model
 	Error        bool
 	Ready        bool
 	spinner      spinner.Model
+	Keys         keyMap
+	// first key of a pending key sequence, e.g. "g" in "g g"
+	KeyPrefix string
+	Help      help.Model
+	ShowHelp  bool
+	Theme     string
+	// preview pane of the browser
+	ShowPreview   bool
+	Preview       preview
+	PreviewTarget string
+	PreviewSeq    int
+	// document properties, nil while they are read
+	ShowInfo bool
+	Info     *DocInfoMsg
+	// password prompt for encrypted PDFs
+	PasswordMode  bool
+	PasswordInput textinput.Model
+	PasswordErr   error
+	// the load that needed the password, retried once it is typed
+	PasswordFor LoadContentMsg
+	// prompt for the file to export the document to, see export.go
+	ExportMode  bool
+	ExportInput textinput.Model
+	// error shown in the status bar until a key is pressed
+	Failure *ErrorMsg
+	// documents of the library folders, see libraryview.go
+	LibraryMode     bool
+	Library         list.Model
+	LibraryGrouping libraryGrouping
+	LibraryScanning bool
+	// full-text search of the library, see searchview.go
+	SearchMode    bool
+	SearchInput   textinput.Model
+	SearchResults list.Model
+	SearchQuery   string
+	Indexing      bool
+	// comparison of two documents, see diffview.go
+	DiffMode bool
+	DiffOld  string
+	DiffNew  string
+	Diff     *docDiff
+	DiffView viewport.Model
+	// first line of every change in DiffView and the current one
+	DiffHunks []int
+	DiffHunk  int
+	// quick switcher over the recent and library documents, see switcher.go
+	ShowSwitcher    bool
+	SwitcherInput   textinput.Model
+	SwitcherItems   []switchItem
+	SwitcherMatches []switchItem
+	SwitcherIdx     int
 }
 
 var listHeight = screenHeight() - 2
-var client *gosseract.Client
-var pwd string
-
-const useHighPerformanceRenderer = false
 
 const version = "1.0.1"
 
+// styles set from the current theme by applyTheme
 var (
-	titleStyle         = lipgloss.NewStyle().MarginLeft(2)
-	itemStyle          = lipgloss.NewStyle().PaddingLeft(4)
-	selectedItemStyle  = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("FFFAE0")).Background(lipgloss.Color("002236"))
-	paginationStyle    = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
-	helpStyle          = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
-	titleStyleViewport = func() lipgloss.Style {
-		b := lipgloss.RoundedBorder()
-		b.Right = "├"
-		return lipgloss.NewStyle().BorderStyle(b).Padding(0, 1)
-	}()
-
-	infoStyle = func() lipgloss.Style {
-		b := lipgloss.RoundedBorder()
-		b.Left = "┤"
-		return titleStyle.Copy().BorderStyle(b)
-	}()
-	textStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("252")).Render
-	spinnerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("69"))
+	titleStyle         lipgloss.Style
+	itemStyle          lipgloss.Style
+	selectedItemStyle  lipgloss.Style
+	paginationStyle    lipgloss.Style
+	helpStyle          lipgloss.Style
+	titleStyleViewport lipgloss.Style
+	infoStyle          lipgloss.Style
+	bodyStyle          lipgloss.Style
+	textStyle          func(...string) string
+	mutedStyle         lipgloss.Style
+	spinnerStyle       lipgloss.Style
+	helpBoxStyle       lipgloss.Style
+	previewBoxStyle    lipgloss.Style
+	highlightStyle     lipgloss.Style
+	matchStyle         lipgloss.Style
+	errorStyle         lipgloss.Style
+	tabStyle           lipgloss.Style
+	activeTabStyle     lipgloss.Style
+	insertedStyle      lipgloss.Style
+	deletedStyle       lipgloss.Style
 )
 
-type item string
-
-func (i item) FilterValue() string { return "" }
-
-type itemDelegate struct{}
-
-func (d itemDelegate) Height() int                             { return 1 }
-func (d itemDelegate) Spacing() int                            { return 0 }
-func (d itemDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
-func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
-	i, ok := listItem.(item)
-	if !ok {
-		return
+func (m model) Init() tea.Cmd {
+	cmds := []tea.Cmd{textinput.Blink, loadFileMetaCmd(m.List), scanLibraryCmd()}
+	// lumus diff starts on the comparison
+	if m.DiffMode {
+		cmds = append(cmds, compareCmd(m.DiffOld, m.DiffNew))
 	}
-
-	str := fmt.Sprintf("%s", i)
-
-	fn := itemStyle.Render
-	if index == m.Index() {
-		fn = func(s ...string) string {
-			return selectedItemStyle.Render("→ " + strings.Join(s, " "))
-		}
+	// a document given on the command line
+	if len(m.Tabs) > 0 && m.Loading {
+		cmds = append(cmds, m.reloadCmd())
 	}
-
-	fmt.Fprint(w, fn(str))
-}
-
-func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	if conf.AutoReload {
+		cmds = append(cmds, watchCmd())
+	}
+	return tea.Batch(cmds...)
 }
 
 type MsgType int
@@ -117,6 +161,14 @@ const (
 func main() {
 	// -v
 	showVersion := flag.Bool("v", false, "Show version")
+	// --config
+	configFile := flag.String("config", "", "Path to the config file (default $XDG_CONFIG_HOME/lumus/config.toml)")
+	// --password
+	password := flag.String("password", "", "Password of encrypted PDFs (default $LUMUS_PDF_PASSWORD)")
+	// --listen
+	listen := flag.String("listen", "", "Serve JSON-RPC for editors on a socket, e.g. unix:/tmp/lumus.sock")
+	// --synctex-forward
+	synctexForward := flag.String("synctex-forward", "", "Open the page of a LaTeX source line, file.tex:line [file.pdf]")
 
 	// parse command line arguments
 	flag.Parse()
@@ -126,53 +178,87 @@ func main() {
 		os.Exit(0)
 	}
 
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
-	client = gosseract.NewClient()
-
-	// Configure languages for English, Spanish and Brazilian Portuguese
-	client.Languages = []string{"eng", "spa", "por+por"}
-	defer client.Close()
-
-	if _, err := p.Run(); err != nil {
-		fmt.Println("Error starting program:", err)
-		os.Exit(1)
+	defaultPassword = *password
+	if defaultPassword == "" {
+		defaultPassword = os.Getenv("LUMUS_PDF_PASSWORD")
 	}
-}
 
-func initialModel() model {
-	files, err := os.ReadDir(".")
+	path, explicit := configPath(), false
+	if *configFile != "" {
+		path, explicit = *configFile, true
+	}
+	cfg, err := loadConfig(path, explicit)
 	if err != nil {
-		fmt.Println("Error reading directory", err)
+		fmt.Println("Error in config file:", err)
 		os.Exit(1)
 	}
+	conf = cfg
+	pages = newPageCache(conf.CacheSize)
+	applyTheme(themes[conf.Theme])
 
-	pwd, err = os.Getwd()
-	if err != nil {
-		fmt.Println("Error reading directory path", err)
-		os.Exit(1)
+	defer ocrClients.close()
+
+	// validated with the rest of the config
+	keys, _ := newKeyMap(conf.Keymap, conf.Keys)
+
+	if *listen != "" {
+		if rpc, err = listenRPC(*listen); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		defer rpc.close()
 	}
 
-	var filteredFiles []os.DirEntry
-	for _, file := range files {
-		if file.IsDir() || strings.HasSuffix(file.Name(), ".pdf") {
-			filteredFiles = append(filteredFiles, file)
+	if *synctexForward != "" {
+		m, err := forwardSearch(keys, *synctexForward, flag.Args())
+		if err == nil {
+			err = runReader(m)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
 		}
+		return
 	}
 
-	items := []list.Item{}
-	for _, file := range filteredFiles {
-		items = append(items, item(file.Name()))
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(args); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	const defaultWidth = 20
+	startDir := "."
+	if conf.StartDir != "" {
+		startDir = expandHome(conf.StartDir)
+	}
+	if err := runReader(initialModel(keys, startDir)); err != nil {
+		fmt.Println("Error starting program:", err)
+		os.Exit(1)
+	}
+}
 
-	l := list.New(items, itemDelegate{}, defaultWidth, listHeight)
-	l.Title = "Lumus"
-	l.SetShowStatusBar(false)
-	l.SetFilteringEnabled(false)
-	l.Styles.Title = titleStyle
-	l.Styles.PaginationStyle = paginationStyle
-	l.Styles.HelpStyle = helpStyle
+// runReader runs the interactive reader until it quits.
+func runReader(m model) error {
+	// errors are shown in the status bar, their details go to the log
+	if f, err := openDebugLog(); err == nil {
+		defer f.Close()
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+	if rpc != nil {
+		go rpc.serve(p)
+	}
+	_, err := p.Run()
+	return err
+}
+
+func initialModel(keys keyMap, dir string) model {
+	b, err := newBrowser(dir, sortByName)
+	if err != nil {
+		fmt.Println("Error reading directory", err)
+		os.Exit(1)
+	}
 
 	ti := textinput.New()
 	ti.Placeholder = "10"
@@ -184,44 +270,74 @@ func initialModel() model {
 	sp.Spinner = spinner.Wand
 	sp.Style = spinnerStyle
 
-	return model{
-		Files:        filteredFiles,
-		CurrentIdx:   0,
-		Content:      "Select a file to view its content",
-		ReadingMode:  false,
-		CurrentPage:  1,
-		GoToPageMode: false,
-		List:         l,
-		TextInput:    ti,
-		Error:        false,
-		Ready:        false,
-		spinner:      sp,
+	m := model{
+		browser:       b,
+		document:      document{Content: "Select a file to view its content", CurrentPage: 1},
+		ReadingMode:   false,
+		GoToPageMode:  false,
+		TextInput:     ti,
+		Error:         false,
+		Ready:         false,
+		spinner:       sp,
+		Keys:          keys,
+		Help:          help.New(),
+		ShowPreview:   conf.Preview,
+		SyncScroll:    conf.SyncScroll,
+		PasswordInput: newPasswordInput(),
+		ExportInput:   newExportInput(),
+		SearchInput:   newSearchInput(),
+		SwitcherInput: newSwitcherInput(),
+		// the library is rescanned then indexed on start, see Init
+		LibraryScanning: len(lib.roots()) > 0,
+		Indexing:        len(lib.roots()) > 0,
 	}
+	m.setTheme(conf.Theme)
+	if conf.RecentAtStart && len(history.recent(1)) > 0 {
+		m, _ = m.openSwitcher()
+	}
+	return m
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	nm, ok := next.(model)
+	if !ok {
+		return next, cmd
+	}
+	if rpc != nil {
+		rpc.observe(nm.readerState())
+	}
+	// follow the selection of the browser with the preview pane
+	if !nm.ReadingMode && !nm.LibraryMode && !nm.SearchMode && !nm.DiffMode {
+		nm.layoutBrowser()
+		if nm.ShowPreview {
+			return nm, tea.Batch(cmd, nm.schedulePreview())
+		}
+	}
+	return nm, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var teaCmds []tea.Cmd
 	var teaCmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.List.SetWidth(msg.Width)
-		headerHeight := lipgloss.Height(m.headerView(m.FileName))
-		footerHeight := lipgloss.Height(m.footerView())
-		verticalMarginHeight := headerHeight + footerHeight
-
+		if m.LibraryMode {
+			m.Library.SetWidth(msg.Width)
+		}
+		if m.SearchMode {
+			m.SearchResults.SetWidth(msg.Width)
+		}
+		m.renderDiff()
 		if !m.Ready {
-			m.Viewport = viewport.New(screenWidth(), screenHeight()-verticalMarginHeight)
-			m.Viewport.YPosition = headerHeight
-			m.Viewport.HighPerformanceRendering = useHighPerformanceRenderer
+			m.Viewport = m.newViewport()
 			m.Viewport.SetContent(m.Content)
 			m.Ready = true
-			// Render the viewport one line below the header.
-			m.Viewport.YPosition = headerHeight + 1
 		} else {
-			m.Viewport.Width = screenWidth()
-			m.Viewport.Height = screenHeight() - verticalMarginHeight
+			m.layoutViewport()
 		}
-		if useHighPerformanceRenderer {
+		if conf.HighPerformanceRenderer {
 			// Render (or re-render) the whole viewport. Necessary both to
 			// initialize the viewport and when the window is resized.
 			//
@@ -232,6 +348,30 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.handleKeyMsg(msg)
 	case LoadContentMsg:
 		return m.handleLoadContentMsg(msg)
+	case LoadWindowPageMsg:
+		return m.handleLoadWindowPageMsg(msg)
+	case FileMetaMsg:
+		return m.handleFileMetaMsg(msg)
+	case previewTickMsg:
+		return m.handlePreviewTickMsg(msg)
+	case PreviewMsg:
+		return m.handlePreviewMsg(msg)
+	case DocInfoMsg:
+		return m.handleDocInfoMsg(msg)
+	case ErrorMsg:
+		return m.handleErrorMsg(msg)
+	case LibraryScanMsg:
+		return m.handleLibraryScanMsg(msg)
+	case IndexMsg:
+		return m.handleIndexMsg(msg)
+	case DiffMsg:
+		return m.handleDiffMsg(msg)
+	case watchTickMsg:
+		return m.handleWatchTickMsg()
+	case noticeDoneMsg:
+		return m.handleNoticeDoneMsg(msg)
+	case ExportMsg:
+		return m.handleExportMsg(msg)
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -244,70 +384,253 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		teaCmds = append(teaCmds, teaCmd)
 		return m, tea.Batch(teaCmds...)
 	}
+	if m.DiffMode {
+		m.DiffView, teaCmd = m.DiffView.Update(msg)
+		m.DiffHunk = m.currentHunk()
+		return m, teaCmd
+	}
 
 	// Handle keyboard and mouse events in the viewport
 	m.Viewport, teaCmd = m.Viewport.Update(msg)
 	teaCmds = append(teaCmds, teaCmd)
+	if m.ReadingMode {
+		m.syncScroll()
+		teaCmds = append(teaCmds, m.windowEdgeCmd())
+	}
 	m.List, teaCmd = m.List.Update(msg)
 	teaCmds = append(teaCmds, teaCmd)
 	return m, tea.Batch(teaCmds...)
 }
 
+// filtering tells whether a filter of the browser or the library is being
+// typed.
+func (m model) filtering() bool {
+	return m.List.FilterState() == list.Filtering || m.Library.FilterState() == list.Filtering
+}
+
 func (m model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	var teaCmds []tea.Cmd
 	var teaCmd tea.Cmd
 
-	switch keypress := msg.String(); keypress {
-	case "ctrl+c", "ctrl+q", "q", "esc":
-		return m.handleQuitKey()
-	case "enter":
-		i, ok := m.List.SelectedItem().(item)
-		if ok {
-			m.FileName = string(i)
+	if m.PasswordMode {
+		return m.handlePasswordKey(msg)
+	}
+	if m.ExportMode {
+		return m.handleExportInputKey(msg)
+	}
+
+	// any key dismisses the error, the quit keys do nothing else
+	if m.Failure != nil {
+		m.Failure = nil
+		if keyMatches(msg.String(), m.Keys.Quit) {
+			return m, nil
 		}
+	}
+
+	if m.ShowSwitcher {
+		return m.handleSwitcherKey(msg)
+	}
+	if keyMatches(msg.String(), m.Keys.Switcher) && !m.GoToPageMode {
+		return m.openSwitcher()
+	}
+
+	// the query takes every key
+	if m.SearchMode && !m.ReadingMode && !m.GoToPageMode {
+		return m.handleSearchViewKey(msg)
+	}
+
+	// while typing a filter, and to clear it, keys belong to the list, even
+	// the ones starting a sequence
+	if !m.ReadingMode && !m.GoToPageMode {
+		l := &m.List
+		if m.LibraryMode && !m.DiffMode {
+			l = &m.Library
+		}
+		filterState := l.FilterState()
+		if filterState == list.Filtering || (filterState == list.FilterApplied && msg.String() == "esc") {
+			m.KeyPrefix = ""
+			*l, teaCmd = l.Update(msg)
+			return m, teaCmd
+		}
+	}
+
+	keypress := msg.String()
+	if m.KeyPrefix != "" {
+		keypress = m.KeyPrefix + " " + keypress
+		m.KeyPrefix = ""
+	} else if !m.GoToPageMode && !m.filtering() && m.Keys.isPrefix(keypress) {
+		m.KeyPrefix = keypress
+		return m, nil
+	}
+
+	if m.ShowHelp {
+		if keyMatches(keypress, m.Keys.Help) || keyMatches(keypress, m.Keys.Quit) {
+			m.ShowHelp = false
+		}
+		return m, nil
+	}
+	if m.ShowInfo {
+		if keyMatches(keypress, m.Keys.Info) || keyMatches(keypress, m.Keys.Quit) {
+			m.ShowInfo = false
+		}
+		return m, nil
+	}
+	if m.DiffMode && !m.GoToPageMode {
+		return m.handleDiffViewKey(msg, keypress)
+	}
+	if m.LibraryMode && !m.ReadingMode && !m.GoToPageMode {
+		return m.handleLibraryListKey(msg, keypress)
+	}
+
+	switch {
+	case keyMatches(keypress, m.Keys.Quit):
+		return m.handleQuitKey()
+	case keyMatches(keypress, m.Keys.Open):
 		return m.handleEnterKey()
-	case "up", "w":
-		return m.handleUpKey(msg)
-	case "down", "s":
-		return m.handleDownKey(msg)
-	case "right", "d":
-		return m.handleRightKey()
-	case "left", "a":
-		return m.handleLeftKey()
-	case "backspace":
+	case keyMatches(keypress, m.Keys.Back):
 		return m.handleBackspaceKey(msg)
-	case "p":
-		return m.handleGoToPage(msg)
 	}
 	if m.GoToPageMode {
 		m.TextInput, teaCmd = m.TextInput.Update(msg)
 		teaCmds = append(teaCmds, teaCmd)
 		return m, tea.Batch(teaCmds...)
 	}
-	m.List, teaCmd = m.List.Update(msg)
-	teaCmds = append(teaCmds, teaCmd)
+
+	switch {
+	case keyMatches(keypress, m.Keys.Help):
+		m.ShowHelp = true
+		return m, nil
+	case keyMatches(keypress, m.Keys.Up):
+		return m.handleUpKey()
+	case keyMatches(keypress, m.Keys.Down):
+		return m.handleDownKey()
+	case keyMatches(keypress, m.Keys.HalfPageUp):
+		return m.handleScrollKey(func(v *viewport.Model) { v.HalfViewUp() }, (*list.Model).PrevPage)
+	case keyMatches(keypress, m.Keys.HalfPageDown):
+		return m.handleScrollKey(func(v *viewport.Model) { v.HalfViewDown() }, (*list.Model).NextPage)
+	case keyMatches(keypress, m.Keys.PageUp):
+		return m.handleScrollKey(func(v *viewport.Model) { v.ViewUp() }, (*list.Model).PrevPage)
+	case keyMatches(keypress, m.Keys.PageDown):
+		return m.handleScrollKey(func(v *viewport.Model) { v.ViewDown() }, (*list.Model).NextPage)
+	case keyMatches(keypress, m.Keys.Top):
+		return m.handleScrollKey(func(v *viewport.Model) { v.GotoTop() }, func(l *list.Model) { l.Select(0) })
+	case keyMatches(keypress, m.Keys.Bottom):
+		return m.handleScrollKey(func(v *viewport.Model) { v.GotoBottom() }, func(l *list.Model) { l.Select(len(l.Items()) - 1) })
+	case keyMatches(keypress, m.Keys.NextPage):
+		return m.handleRightKey()
+	case keyMatches(keypress, m.Keys.PrevPage):
+		return m.handleLeftKey()
+	case keyMatches(keypress, m.Keys.GoToPage):
+		return m.handleGoToPage(msg)
+	case keyMatches(keypress, m.Keys.ToggleHeaders):
+		return m.handleRunningLinesKey()
+	case keyMatches(keypress, m.Keys.Continuous):
+		return m.handleContinuousKey()
+	case keyMatches(keypress, m.Keys.Sort):
+		return m.handleSortKey()
+	case keyMatches(keypress, m.Keys.Hidden):
+		return m.handleHiddenKey()
+	case keyMatches(keypress, m.Keys.Library):
+		return m.handleLibraryKey()
+	case keyMatches(keypress, m.Keys.Search):
+		return m.handleSearchKey()
+	case keyMatches(keypress, m.Keys.Split):
+		return m.handleSplitKey()
+	case keyMatches(keypress, m.Keys.SwitchPane):
+		return m.handlePaneKey()
+	case keyMatches(keypress, m.Keys.SyncScroll):
+		return m.handleSyncScrollKey()
+	case keyMatches(keypress, m.Keys.Diff):
+		return m.handleDiffKey()
+	case keyMatches(keypress, m.Keys.InverseSearch):
+		return m.handleInverseSearchKey()
+	case keyMatches(keypress, m.Keys.Export):
+		return m.handleExportKey()
+	case keyMatches(keypress, m.Keys.NextTab):
+		return m.handleTabKey(1)
+	case keyMatches(keypress, m.Keys.PrevTab):
+		return m.handleTabKey(-1)
+	case keyMatches(keypress, m.Keys.Preview):
+		return m.handlePreviewKey()
+	case keyMatches(keypress, m.Keys.Info):
+		return m.handleInfoKey()
+	case keyMatches(keypress, m.Keys.Theme):
+		m.setTheme(nextThemeName(m.Theme))
+		if m.Continuous && len(m.Window) > 0 {
+			m.setWindowContent()
+		}
+		return m, nil
+	}
+	if !m.ReadingMode {
+		m.List, teaCmd = m.List.Update(msg)
+		teaCmds = append(teaCmds, teaCmd)
+	}
 	return m, tea.Batch(teaCmds...)
 }
 
 func (m model) handleLoadContentMsg(msg LoadContentMsg) (tea.Model, tea.Cmd) {
-	content, totalPages, err := readPDFFile(msg.FileName, msg.Page)
+	if msg.Open {
+		m.ShowSwitcher, m.SearchMode, m.LibraryMode = false, false, false
+		m.ShowHelp, m.ShowInfo, m.GoToPageMode = false, false, false
+		// the page is loaded right here rather than by the command
+		_ = m.openDocument(msg.FileName, msg.Page)
+		if msg.Query != "" {
+			m.Highlight = parseQuery(msg.Query)
+		}
+		msg.Open = false
+	}
+	// another tab was shown while the new version was read
+	if msg.Reload && msg.FileName != m.FileName {
+		return m, nil
+	}
+	content, totalPages, err := readPDFPage(msg.FileName, msg.Page, m.ShowRunningLines, m.textWidth())
+	if isPasswordError(err) {
+		return m.askPassword(msg, err)
+	}
+	// the document itself could not be opened, stay where we were
+	if err != nil && totalPages == 0 {
+		m.dropUnopenedTab()
+		return m.showError("open "+msg.FileName, err)
+	}
 	if err != nil {
-		content = fmt.Sprintf("Error reading file %s : %v", pwd+"/"+msg.FileName, err)
+		log.Printf("page %d of %s: %v", msg.Page, msg.FileName, err)
+		content = fmt.Sprintf("Error reading file %s : %v", msg.FileName, err)
 		totalPages = 0
+	} else {
+		_ = history.record(msg.FileName, msg.Page, totalPages)
+		m.Stamp, _ = statStamp(msg.FileName)
+	}
+	matchLine := -1
+	if len(m.Highlight) > 0 {
+		content, matchLine = highlightMatches(content, m.Highlight)
 	}
 	m.Content = content
 	m.Viewport.SetContent(content)
+	if m.Continuous {
+		m.Window = []windowPage{newWindowPage(msg.Page, content)}
+		m.setWindowContent()
+	}
 
 	//reset scroll
 	m.Viewport.GotoTop()
+	// keep a couple of lines of context above the first match
+	if matchLine > 2 {
+		m.Viewport.SetYOffset(matchLine - 2)
+	}
 
 	m.TotalPages = totalPages
+	if msg.Reload {
+		// stay where the reader was, without the loading animation
+		m.Viewport.SetYOffset(msg.Offset)
+		cmd := m.showNotice("reloaded")
+		return m, cmd
+	}
 	m.ReadingMode = true
 	var teaCmds []tea.Cmd
 	var teaCmd tea.Cmd
 	teaCmd = m.spinner.Tick
 	teaCmds = append(teaCmds, teaCmd)
-	teaCmd = tea.Tick(4*time.Second, func(time.Time) tea.Msg {
+	teaCmd = tea.Tick(conf.LoadingDelay.Duration, func(time.Time) tea.Msg {
 		return LoadingDone
 	})
 	teaCmds = append(teaCmds, teaCmd)
@@ -323,10 +646,20 @@ func (m model) handleMsgType(msg MsgType) (tea.Model, tea.Cmd) {
 }
 
 func (m model) handleQuitKey() (tea.Model, tea.Cmd) {
+	if m.ReadingMode && m.Split {
+		return m.closeSplit()
+	}
+	if m.ReadingMode && len(m.Tabs) > 1 {
+		m.closeTab()
+		return m, nil
+	}
 	if m.ReadingMode {
+		m.Tabs = nil
 		m.ReadingMode = false
 		m.GoToPageMode = false
 		m.CurrentPage = 1
+		m.Window = nil
+		m.Highlight = nil
 		return m, nil
 	}
 	if m.GoToPageMode {
@@ -350,112 +683,68 @@ func (m model) handleEnterKey() (tea.Model, tea.Cmd) {
 		m.TextInput.SetValue("")
 		m.GoToPageMode = false
 		return m, func() tea.Msg {
-			return LoadContentMsg{FileName: m.Files[m.CurrentIdx].Name(), Page: m.CurrentPage}
+			return LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage}
 		}
 	}
-	selectedFile := m.Files[m.CurrentIdx]
-	if selectedFile.IsDir() {
-		err := os.Chdir(pwd + "/" + selectedFile.Name())
-		if err != nil {
-			fmt.Println("Error when changing directory", err)
-			os.Exit(1)
-		}
-		files, err := os.ReadDir(".")
-		if err != nil {
-			fmt.Println("Error reading directory", err)
-			os.Exit(1)
-		}
-		pwd, err = os.Getwd()
-		if err != nil {
-			fmt.Println("Error reading directory path", err)
-			os.Exit(1)
-		}
-		var filteredFiles []os.DirEntry
-		for _, file := range files {
-			if file.IsDir() || strings.HasSuffix(file.Name(), ".pdf") {
-				filteredFiles = append(filteredFiles, file)
-			}
-		}
-		items := []list.Item{}
-		for _, file := range filteredFiles {
-			items = append(items, item(file.Name()))
-		}
-
-		const defaultWidth = 20
-
-		l := list.New(items, itemDelegate{}, defaultWidth, listHeight)
-		l.Title = "Lumus"
-		l.SetShowStatusBar(false)
-		l.SetFilteringEnabled(false)
-		l.Styles.Title = titleStyle
-		l.Styles.PaginationStyle = paginationStyle
-		l.Styles.HelpStyle = helpStyle
-
-		m.List = l
-		m.Files = filteredFiles
-		m.CurrentIdx = 0
-		m.Content = "Select a file to view its content"
-
+	i, ok := m.List.SelectedItem().(item)
+	if !ok {
 		return m, nil
 	}
+	if i.IsDir {
+		return m.changeDir(i.path())
+	}
+	if !m.ReadingMode {
+		cmd := m.openDocument(i.path(), 1)
+		return m, cmd
+	}
 	m.Loading = true
 	return m, func() tea.Msg {
-		return LoadContentMsg{FileName: m.Files[m.CurrentIdx].Name(), Page: m.CurrentPage}
+		return LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage}
 	}
 
 }
 
-func (m model) handleUpKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	var teaCmd tea.Cmd
-	var teaCmds []tea.Cmd
-	if m.ReadingMode {
-		m.Viewport, teaCmd = m.Viewport.Update(msg)
-		teaCmds = append(teaCmds, teaCmd)
-		return m, tea.Batch(teaCmds...)
-	}
-	m.CurrentIdx--
-	if m.CurrentIdx < 0 {
-		m.CurrentIdx = 0
-	}
-	var cmd tea.Cmd
-	m.List, cmd = m.List.Update(msg)
-	return m, cmd
+func (m model) handleUpKey() (tea.Model, tea.Cmd) {
+	return m.handleScrollKey(func(v *viewport.Model) { v.LineUp(1) }, (*list.Model).CursorUp)
 }
 
-func (m model) handleDownKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	var teaCmd tea.Cmd
-	var teaCmds []tea.Cmd
+func (m model) handleDownKey() (tea.Model, tea.Cmd) {
+	return m.handleScrollKey(func(v *viewport.Model) { v.LineDown(1) }, (*list.Model).CursorDown)
+}
+
+// handleScrollKey moves the viewport in reading mode and the list cursor
+// in the file browser.
+func (m model) handleScrollKey(scrollViewport func(*viewport.Model), moveList func(*list.Model)) (tea.Model, tea.Cmd) {
 	if m.ReadingMode {
-		m.Viewport, teaCmd = m.Viewport.Update(msg)
-		teaCmds = append(teaCmds, teaCmd)
-		return m, tea.Batch(teaCmds...)
-	}
-	m.CurrentIdx++
-	if m.CurrentIdx >= len(m.Files) {
-		m.CurrentIdx = len(m.Files) - 1
+		scrollViewport(&m.Viewport)
+		m.syncScroll()
+		// windowEdgeCmd sets WindowLoading, m is returned once it has
+		cmd := m.windowEdgeCmd()
+		return m, cmd
 	}
-	var cmd tea.Cmd
-	m.List, cmd = m.List.Update(msg)
-	return m, cmd
+	moveList(&m.List)
+	return m, nil
 }
 
 func (m model) handleRightKey() (tea.Model, tea.Cmd) {
+	m.CurrentPage = m.visiblePage()
 	if m.ReadingMode && m.CurrentPage < m.TotalPages {
 		m.CurrentPage++
 		m.Viewport.YPosition = 0
 		return m, func() tea.Msg {
-			return LoadContentMsg{FileName: m.Files[m.CurrentIdx].Name(), Page: m.CurrentPage}
+			return LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage}
 		}
 	}
 	return m, nil
 }
 
 func (m model) handleLeftKey() (tea.Model, tea.Cmd) {
+	m.CurrentPage = m.visiblePage()
 	if m.ReadingMode && m.CurrentPage > 1 {
 		m.CurrentPage--
 		m.Viewport.YPosition = 0
 		return m, func() tea.Msg {
-			return LoadContentMsg{FileName: m.Files[m.CurrentIdx].Name(), Page: m.CurrentPage}
+			return LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage}
 		}
 	}
 	return m, nil
@@ -463,49 +752,11 @@ func (m model) handleLeftKey() (tea.Model, tea.Cmd) {
 
 func (m model) handleBackspaceKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	if !m.ReadingMode && !m.GoToPageMode {
-		dir, _ := filepath.Split(pwd)
-		parentDir := filepath.Dir(dir)
-		err := os.Chdir(parentDir)
-		if err != nil {
-			fmt.Println("Error when changing directory", err)
-			os.Exit(1)
-		}
-		files, err := os.ReadDir(".")
-		if err != nil {
-			fmt.Println("Error reading directory", err)
-			os.Exit(1)
-		}
-		pwd, err = os.Getwd()
-		if err != nil {
-			fmt.Println("Error reading directory path", err)
-			os.Exit(1)
-		}
-
-		var filteredFiles []os.DirEntry
-		for _, file := range files {
-			if file.IsDir() || strings.HasSuffix(file.Name(), ".pdf") {
-				filteredFiles = append(filteredFiles, file)
-			}
-		}
-		items := []list.Item{}
-		for _, file := range filteredFiles {
-			items = append(items, item(file.Name()))
-		}
-
-		const defaultWidth = 20
-
-		l := list.New(items, itemDelegate{}, defaultWidth, listHeight)
-		l.Title = "Lumus"
-		l.SetShowStatusBar(false)
-		l.SetFilteringEnabled(false)
-		l.Styles.Title = titleStyle
-		l.Styles.PaginationStyle = paginationStyle
-		l.Styles.HelpStyle = helpStyle
-
-		m.List = l
-		m.Files = filteredFiles
-		m.CurrentIdx = 0
-		m.Content = "Select a file to view its content"
+		return m.changeDir(filepath.Dir(m.Dir))
+	}
+	// back to the browser, the tabs stay open
+	if m.ReadingMode {
+		m.ReadingMode = false
 		return m, nil
 	}
 	var cmd tea.Cmd
@@ -517,6 +768,16 @@ func (m model) handleBackspaceKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// changeDir moves the browser to dir, a failure leaves it where it was.
+func (m model) changeDir(dir string) (tea.Model, tea.Cmd) {
+	cmd, err := m.open(dir)
+	if err != nil {
+		return m.showError("open directory "+dir, err)
+	}
+	m.Content = "Select a file to view its content"
+	return m, cmd
+}
+
 func (m model) handleGoToPage(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	if !m.ReadingMode && !m.GoToPageMode {
 		return m, nil
@@ -527,19 +788,64 @@ func (m model) handleGoToPage(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m model) handleRunningLinesKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode {
+		return m, nil
+	}
+	m.ShowRunningLines = !m.ShowRunningLines
+	m.CurrentPage = m.visiblePage()
+	return m, func() tea.Msg {
+		return LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage}
+	}
+}
+
 func (m model) handleLoadingDone() (tea.Model, tea.Cmd) {
 	m.Loading = false
 	return m, nil
 }
 
 func (m model) View() string {
+	return m.withStatus(m.view())
+}
+
+func (m model) view() string {
 	if m.Loading {
 		gap := "\n"
 		return fmt.Sprintf("\n %s%s%s\n\n", textStyle(""), gap, m.spinner.View())
 	}
 
+	if m.PasswordMode {
+		return lipgloss.Place(screenWidth(), screenHeight(), lipgloss.Center, lipgloss.Center, m.passwordView())
+	}
+	if m.ExportMode {
+		return lipgloss.Place(screenWidth(), screenHeight(), lipgloss.Center, lipgloss.Center, m.exportView())
+	}
+
+	if m.ShowSwitcher {
+		return m.switcherView()
+	}
+
+	if m.ShowHelp {
+		return m.helpView()
+	}
+
+	if m.ShowInfo {
+		return m.infoView()
+	}
+
+	if m.DiffMode {
+		return m.diffView()
+	}
+
 	if m.ReadingMode {
-		return fmt.Sprintf("%s\n%s\n%s", m.headerView(m.FileName), m.Viewport.View(), m.footerView())
+		view := fmt.Sprintf("%s\n%s\n%s", m.headerView(m.FileName), m.Viewport.View(), m.footerView())
+		if m.Split {
+			view = m.splitView()
+		}
+		if m.showTabBar() {
+			return m.tabBarView() + "\n" + view
+		}
+		return view
 	}
 
 	if m.GoToPageMode {
@@ -549,6 +855,17 @@ func (m model) View() string {
 		return fmt.Sprintf("Go to Page: \n%s\n%s\n%s", m.TextInput.View(), "(q to quit)", "Non-existent page")
 	}
 
+	if m.SearchMode {
+		return m.searchView()
+	}
+
+	if m.LibraryMode {
+		return m.libraryView()
+	}
+
+	if m.ShowPreview {
+		return "\n" + lipgloss.JoinHorizontal(lipgloss.Top, m.List.View(), m.previewView())
+	}
 	return "\n" + m.List.View()
 }
 
@@ -570,108 +887,238 @@ func max(a, b int) int {
 }
 
 func (m model) headerView(name string) string {
-	title := titleStyleViewport.Render(pwd + "/" + name)
+	title := titleStyleViewport.Render(name)
 	line := strings.Repeat("─", max(0, m.Viewport.Width-lipgloss.Width(title)))
 	return lipgloss.JoinHorizontal(lipgloss.Center, title, line)
 }
 
 func (m model) footerView() string {
-	info := infoStyle.Render(fmt.Sprintf("%3.f%% Page %d/%d ", m.Viewport.ScrollPercent()*100, m.CurrentPage, m.TotalPages))
-	str := "Press 'p' to Go To Page. Arrow Keys to change of page. "
-	line := str + strings.Repeat(" ", max(0, m.Viewport.Width-(lipgloss.Width(info)+len(str))))
+	info := infoStyle.Render(fmt.Sprintf("%3.f%% Page %d/%d ", m.Viewport.ScrollPercent()*100, m.visiblePage(), m.TotalPages))
+	str := m.Help.ShortHelpView(m.Keys.ShortHelp()) + " "
+	if m.Split {
+		// no room for the help in a pane
+		str = ""
+		if m.SyncScroll {
+			str = mutedStyle.Render(" sync scroll ")
+		}
+	}
+	if m.Notice != "" {
+		str = mutedStyle.Render(" " + m.Notice + " ")
+	}
+	line := str + strings.Repeat(" ", max(0, m.Viewport.Width-(lipgloss.Width(info)+lipgloss.Width(str))))
 	return lipgloss.JoinHorizontal(lipgloss.Center, line, info)
 }
 
+func (m model) helpView() string {
+	m.Help.ShowAll = true
+	box := helpBoxStyle.Render(m.Help.View(m.Keys))
+	return lipgloss.Place(screenWidth(), screenHeight(), lipgloss.Center, lipgloss.Center, box)
+}
+
 type LoadContentMsg struct {
 	FileName string
 	Page     int
+	// the file changed on disk, the page is read again at the line Offset
+	Reload bool
+	Offset int
+	// sent by the control server: the document is shown in its tab first,
+	// highlighting the matches of Query
+	Open  bool
+	Query string
+}
+
+// pageSource is what an extractor needs to read one page.
+type pageSource struct {
+	// path of the whole document
+	FileName string
+	Reader   *pdf.Reader
+	Page     int
+	// directory holding the page extracted as a single page PDF
+	OutputDir string
+	PagePath  string
+	// pdfcpu configuration with the document password
+	PDFConf *pdfmodel.Configuration
+}
+
+// pageText is a page as read by an extractor.
+type pageText struct {
+	Text string
+	// name of the extractor that read the page
+	Method string
+	// mean confidence of the words found by OCR, from 0 to 100
+	Confidence float64
+}
+
+type extractor func(src pageSource) (pageText, error)
+
+// extractors that can be listed in the extraction_order config
+var extractors = map[string]extractor{
+	"docconv": func(src pageSource) (pageText, error) {
+		res, err := docconv.ConvertPath(src.PagePath)
+		if err != nil {
+			return pageText{}, err
+		}
+		return pageText{Text: res.Body}, nil
+	},
+	"text": func(src pageSource) (page pageText, err error) {
+		// the pdf reader panics on some malformed pages, the next extractor
+		// may still read them
+		defer func() {
+			if r := recover(); r != nil {
+				page, err = pageText{}, fmt.Errorf("malformed page: %v", r)
+			}
+		}()
+		text, err := src.Reader.Page(src.Page).GetPlainText(nil)
+		return pageText{Text: text}, err
+	},
+	"ocr": func(src pageSource) (pageText, error) {
+		text, confidence, err := apiExtractText(src.FileName, src.OutputDir, []string{strconv.Itoa(src.Page)}, src.PDFConf)
+		return pageText{Text: text, Confidence: confidence}, err
+	},
 }
 
-func readPDFFile(fileName string, pageNum int) (string, int, error) {
-	filepath := pwd + "/" + fileName
-	f, r, err := pdf.Open(filepath)
+func extractorNames() []string {
+	names := make([]string, 0, len(extractors))
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readPDFPage extracts the text of a page wrapped to width columns, a
+// width of 0 keeps the lines as extracted.
+func readPDFPage(filepath string, pageNum int, keepRunningLines bool, width int) (string, int, error) {
+	page, totalPages, err := extractPage(filepath, pageNum, keepRunningLines, width)
+	return page.Text, totalPages, err
+}
+
+// extractPage is readPDFPage telling how the page was read too.
+func extractPage(filepath string, pageNum int, keepRunningLines bool, width int) (pageText, int, error) {
+	info, err := os.Stat(filepath)
 	if err != nil {
-		return err.Error(), 0, err
+		return pageText{Text: err.Error()}, 0, err
+	}
+	key := pageKey{Path: filepath, ModTime: info.ModTime().UnixNano(), Page: pageNum, Width: width, KeepRunningLines: keepRunningLines}
+	if cached, ok := pages.get(key); ok {
+		return cached.Page, cached.TotalPages, nil
+	}
+
+	f, r, err := openPDF(filepath)
+	if err != nil {
+		return pageText{Text: err.Error()}, 0, err
 	}
 
 	totalPages := r.NumPage()
 	defer f.Close()
 
-	outputDir := "lumus_extract"
-
-	// extract content
-	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
-		return "", 0, err
+	// extract content, in a directory of its own since the browsed
+	// directory may not be writable
+	outputDir, err := os.MkdirTemp("", "lumus_extract")
+	if err != nil {
+		return pageText{}, 0, err
 	}
 	defer func() {
 		_ = os.RemoveAll(outputDir)
 	}()
 
 	pageSelection := []string{strconv.Itoa(pageNum)}
-	api.ExtractPages(f, outputDir, "lumus_pdf_page", pageSelection, nil)
+	pdfConf := pdfcpuConfig(filepath)
+	api.ExtractPages(f, outputDir, "lumus_pdf_page", pageSelection, pdfConf)
+
+	src := pageSource{
+		FileName:  filepath,
+		Reader:    r,
+		Page:      pageNum,
+		OutputDir: outputDir,
+		PDFConf:   pdfConf,
+		PagePath:  outputDir + "/" + fmt.Sprintf("%s_page_%d.pdf", "lumus_pdf_page", pageNum),
+	}
 
-	readPdfPageFilePath := outputDir + "/" + fmt.Sprintf("%s_page_%d.pdf", "lumus_pdf_page", pageNum)
-	res, err := docconv.ConvertPath(readPdfPageFilePath)
-	if err != nil {
-		text, err := apiExtractText(fileName, outputDir, pageSelection)
+	failed := 0
+	for _, name := range conf.ExtractionOrder {
+		page, err := extractors[name](src)
 		if err != nil {
-			return "", totalPages, errors.New("Sorry, Lumus cannot read this page of the PDF file. But don't worry, it's doing its best! 😊")
+			failed++
+			continue
 		}
-		return text, totalPages, nil
-	}
-
-	pageContent := textWithWidth(res.Body)
-
-	if len(pageContent) > 0 {
-		return pageContent, totalPages, nil
+		if len(strings.TrimSpace(page.Text)) == 0 {
+			continue
+		}
+		page.Method = name
+		if !keepRunningLines {
+			page.Text = stripRunningLines(page.Text, r, pageNum)
+		}
+		// OCR output keeps the line breaks found by tesseract
+		if name != "ocr" && width > 0 {
+			page.Text = textWithWidth(page.Text, width)
+		}
+		pages.put(key, cachedPage{Page: page, TotalPages: totalPages})
+		return page, totalPages, nil
 	}
-
-	text, err := apiExtractText(fileName, outputDir, pageSelection)
-	if err != nil {
-		return pageContent, totalPages, nil
+	if failed == len(conf.ExtractionOrder) {
+		return pageText{}, totalPages, errors.New("Sorry, Lumus cannot read this page of the PDF file. But don't worry, it's doing its best! 😊")
 	}
 
-	return text, totalPages, nil
+	return pageText{}, totalPages, nil
 }
 
-func apiExtractText(filepath string, outputDir string, pageSelection []string) (string, error) {
+// apiExtractText reads the image of a page with tesseract. It returns the
+// text and the mean confidence of its words.
+func apiExtractText(filepath string, outputDir string, pageSelection []string, pdfConf *pdfmodel.Configuration) (string, float64, error) {
 	//configure image extraction options
 
-	if err := api.ExtractImagesFile(filepath, outputDir, pageSelection, nil); err != nil {
-		return "", err
+	if err := api.ExtractImagesFile(filepath, outputDir, pageSelection, pdfConf); err != nil {
+		return "", 0, err
 	}
 
 	imagePath, err := getImageFile(outputDir)
 	if err != nil || imagePath == "" {
-		return "", err
+		return "", 0, err
 	}
 
 	imgFile, err := os.Open(imagePath)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer imgFile.Close()
 
+	// a client reads one image at a time
+	client := ocrClients.get()
+	defer ocrClients.put(client)
 	err = client.SetImage(imagePath)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	text, err := client.Text()
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
+	return text, ocrConfidence(client), nil
+}
 
-	return text, nil
+// ocrConfidence returns the mean confidence of the words of the last
+// image read by a client.
+func ocrConfidence(client *gosseract.Client) float64 {
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+	if err != nil || len(boxes) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, b := range boxes {
+		sum += b.Confidence
+	}
+	return sum / float64(len(boxes))
 }
 
-func textWithWidth(s string) string {
+func textWithWidth(s string, width int) string {
 	if len(s) == 0 {
 		return s
 	}
 
 	text := ""
-	screenWidth := screenWidth() - 1
+	screenWidth := width - 1
 
 	if len(s) > screenWidth {
 		var line string
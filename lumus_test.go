@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func typeKeys(m model, keys ...string) model {
+	for _, k := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		if k == "esc" {
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		}
+		next, _ := m.Update(msg)
+		m = next.(model)
+	}
+	return m
+}
+
+func TestFilterTakesSequenceKeys(t *testing.T) {
+	saved := conf.RecentAtStart
+	defer func() { conf.RecentAtStart = saved }()
+	conf.RecentAtStart = false
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.pdf", "gx.pdf"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0o644)
+	}
+	keys, err := newKeyMap("vim", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(keys, dir)
+
+	// "g" starts "g g" and "g t", not while typing a filter
+	m = typeKeys(m, "/", "g", "x")
+	if got := m.List.FilterValue(); got != "gx" {
+		t.Errorf("browser filter = %q, want gx", got)
+	}
+	if m.KeyPrefix != "" {
+		t.Errorf("key prefix %q while filtering", m.KeyPrefix)
+	}
+	m = typeKeys(m, "esc", "esc")
+	if m.List.FilterState() != list.Unfiltered {
+		t.Errorf("browser filter state = %v after esc", m.List.FilterState())
+	}
+	if m = typeKeys(m, "g"); m.KeyPrefix != "g" {
+		t.Errorf("key prefix = %q out of the filter, want g", m.KeyPrefix)
+	}
+	m.KeyPrefix = ""
+
+	m.LibraryMode = true
+	m.Library = newLibraryList(byAuthor)
+	m.Library.SetItems(libraryItems([]libraryDoc{{Path: "/books/a.pdf", Title: "A"}, {Path: "/books/gx.pdf", Title: "Gx"}}, byAuthor))
+	m = typeKeys(m, "/", "g", "x")
+	if got := m.Library.FilterValue(); got != "gx" {
+		t.Errorf("library filter = %q, want gx", got)
+	}
+	if m.KeyPrefix != "" {
+		t.Errorf("key prefix %q while filtering the library", m.KeyPrefix)
+	}
+	if !m.LibraryMode {
+		t.Error("typing the filter left the library")
+	}
+}
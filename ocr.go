@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/otiai10/gosseract/v2"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// ocrPool hands out tesseract clients, a client being unsafe to share.
+// Clients are made on first use, up to size.
+type ocrPool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int
+	idle []*gosseract.Client
+	all  []*gosseract.Client
+}
+
+// ocrClients serve every OCR of the process, one at a time unless lumus
+// ocr runs more jobs.
+var ocrClients = newOCRPool(1)
+
+func newOCRPool(size int) *ocrPool {
+	p := &ocrPool{size: size}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// get waits for a client, which must be given back with put.
+func (p *ocrPool) get() *gosseract.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.idle) == 0 && len(p.all) >= p.size {
+		p.cond.Wait()
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		return c
+	}
+	c := gosseract.NewClient()
+	c.Languages = conf.OCRLanguages
+	p.all = append(p.all, c)
+	return c
+}
+
+func (p *ocrPool) put(c *gosseract.Client) {
+	p.mu.Lock()
+	p.idle = append(p.idle, c)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+func (p *ocrPool) setSize(size int) {
+	p.mu.Lock()
+	p.size = size
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+func (p *ocrPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.all {
+		c.Close()
+	}
+	p.all, p.idle = nil, nil
+}
+
+// ocrPage reads the image of a page with tesseract, as text and as hOCR.
+func ocrPage(path string, page int) (string, string, error) {
+	dir, err := os.MkdirTemp("", "lumus_ocr")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+	if err := api.ExtractImagesFile(path, dir, []string{strconv.Itoa(page)}, pdfcpuConfig(path)); err != nil {
+		return "", "", err
+	}
+	imagePath, _ := getImageFile(dir)
+	if imagePath == "" {
+		return "", "", errors.New("no image to read on the page")
+	}
+	client := ocrClients.get()
+	defer ocrClients.put(client)
+	if err := client.SetImage(imagePath); err != nil {
+		return "", "", err
+	}
+	text, err := client.Text()
+	if err != nil {
+		return "", "", err
+	}
+	hocr, err := client.HOCRText()
+	if err != nil {
+		return "", "", err
+	}
+	return text, hocr, nil
+}
+
+// The batch OCR writes book.ocr.txt, the text of every page ended by a
+// form feed, and book.ocr.hocr, the hOCR of the scanned pages, next to
+// book.pdf. The .ocr keeps them apart from a book.txt of the user.
+// The pages done so far are kept in .book.pdf.ocr until the document is
+// complete, so that an interrupted run picks up where it stopped.
+
+// ocrDoc is a document of the batch.
+type ocrDoc struct {
+	Path    string
+	Pages   int
+	Scanned map[int]bool
+	// directory of the pages done
+	State string
+
+	mu        sync.Mutex
+	remaining int
+	failed    int
+}
+
+type ocrJob struct {
+	doc  *ocrDoc
+	page int
+}
+
+// ocrStats are the counts of the summary.
+type ocrStats struct {
+	mu sync.Mutex
+	// pages
+	OCRd, Skipped, Failed int
+	// documents
+	Written, UpToDate, NoScans, Incomplete int
+}
+
+func (s *ocrStats) add(f func(s *ocrStats)) {
+	s.mu.Lock()
+	f(s)
+	s.mu.Unlock()
+}
+
+func ocrSidecars(path string) (string, string) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return base + ".ocr.txt", base + ".ocr.hocr"
+}
+
+// ocrUpToDate tells whether the sidecars were written after the PDF.
+func ocrUpToDate(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	txtPath, hocrPath := ocrSidecars(path)
+	for _, sidecar := range []string{txtPath, hocrPath} {
+		if s, err := os.Stat(sidecar); err != nil || s.ModTime().Before(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *ocrDoc) statePath(page int, ext string) string {
+	return filepath.Join(d.State, fmt.Sprintf("page-%04d%s", page, ext))
+}
+
+// runOCR OCRs the scanned pages of PDFs: lumus ocr dir/ [--jobs 4]
+func runOCR(args []string) error {
+	fs := flag.NewFlagSet("ocr", flag.ContinueOnError)
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Pages read at the same time")
+	paths, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 || *jobs < 1 {
+		return errors.New("usage: lumus ocr dir/ [file.pdf...] [--jobs 4]")
+	}
+	files, err := findPDFs(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no PDF files found")
+	}
+
+	stats := &ocrStats{}
+	var queue []ocrJob
+	fmt.Fprintf(os.Stderr, "Looking for scanned pages in %d documents\n", len(files))
+	for _, path := range files {
+		if ocrUpToDate(path) {
+			stats.UpToDate++
+			continue
+		}
+		doc, err := planOCR(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			stats.Incomplete++
+			continue
+		}
+		if len(doc.Scanned) == 0 {
+			stats.NoScans++
+			stats.Skipped += doc.Pages
+			continue
+		}
+		for p := 1; p <= doc.Pages; p++ {
+			if _, err := os.Stat(doc.statePath(p, ".txt")); err == nil {
+				stats.Skipped++
+				continue
+			}
+			doc.remaining++
+			queue = append(queue, ocrJob{doc: doc, page: p})
+		}
+		// resumed with every page done
+		if doc.remaining == 0 {
+			finishOCR(doc, stats)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ocrClients.setSize(*jobs)
+	bar := newOCRProgress(len(queue))
+	jobCh := make(chan ocrJob)
+	var wg sync.WaitGroup
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				runOCRJob(job, stats, bar)
+			}
+		}()
+	}
+	interrupted := false
+	for _, job := range queue {
+		select {
+		case jobCh <- job:
+		case <-ctx.Done():
+			interrupted = true
+		}
+		if interrupted {
+			break
+		}
+	}
+	close(jobCh)
+	wg.Wait()
+	bar.finish()
+
+	fmt.Printf("OCR'd %d pages, skipped %d, failed %d in %s\n", stats.OCRd, stats.Skipped, stats.Failed, bar.elapsed())
+	fmt.Printf("%d documents written, %d up to date, %d without scanned pages", stats.Written, stats.UpToDate, stats.NoScans)
+	if stats.Incomplete > 0 || interrupted {
+		fmt.Printf(", %d incomplete: run the same command again to resume", stats.Incomplete+countUnfinished(queue))
+	}
+	fmt.Println()
+	if interrupted {
+		return errors.New("interrupted")
+	}
+	if stats.Failed > 0 {
+		return fmt.Errorf("%d pages could not be read", stats.Failed)
+	}
+	return nil
+}
+
+// findPDFs lists the PDFs of files and directories, walked recursively.
+func findPDFs(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && isPDF(d.Name()) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isPDF(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".pdf")
+}
+
+// planOCR finds the scanned pages of a document: the ones with images
+// and no fonts.
+func planOCR(path string) (*ocrDoc, error) {
+	info, err := readDocInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &ocrDoc{
+		Path:    path,
+		Pages:   info.Pages,
+		Scanned: make(map[int]bool),
+		State:   filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".ocr"),
+	}
+	for _, p := range info.ImageOnlyPages {
+		doc.Scanned[p] = true
+	}
+	if len(doc.Scanned) > 0 {
+		if err := os.MkdirAll(doc.State, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// runOCRJob reads a page, with tesseract when it is scanned and as the
+// reader does otherwise, and keeps it in the state of the document.
+func runOCRJob(job ocrJob, stats *ocrStats, bar *ocrProgress) {
+	doc, page := job.doc, job.page
+	var text, hocr string
+	var err error
+	if doc.Scanned[page] {
+		text, hocr, err = ocrPage(doc.Path, page)
+	} else {
+		var pt pageText
+		pt, _, err = extractPage(doc.Path, page, true, 0)
+		text = pt.Text
+	}
+	if err == nil && hocr != "" {
+		err = os.WriteFile(doc.statePath(page, ".hocr"), []byte(hocr), 0o644)
+	}
+	if err == nil {
+		// the text last, its presence marks the page as done
+		err = os.WriteFile(doc.statePath(page, ".txt"), []byte(text), 0o644)
+	}
+	switch {
+	case err != nil:
+		stats.add(func(s *ocrStats) { s.Failed++ })
+		bar.printf("%s: page %d: %v", doc.Path, page, err)
+	case doc.Scanned[page]:
+		stats.add(func(s *ocrStats) { s.OCRd++ })
+	default:
+		stats.add(func(s *ocrStats) { s.Skipped++ })
+	}
+	bar.step()
+
+	doc.mu.Lock()
+	doc.remaining--
+	if err != nil {
+		doc.failed++
+	}
+	last := doc.remaining == 0
+	doc.mu.Unlock()
+	if !last {
+		return
+	}
+	if doc.failed > 0 {
+		stats.add(func(s *ocrStats) { s.Incomplete++ })
+		return
+	}
+	if err := finishOCR(doc, stats); err != nil {
+		bar.printf("%s: %v", doc.Path, err)
+	} else {
+		bar.printf("%s: OCR'd %d of %d pages", doc.Path, len(doc.Scanned), doc.Pages)
+	}
+}
+
+// finishOCR writes the sidecars of a document whose pages are all done
+// and removes its state.
+func finishOCR(doc *ocrDoc, stats *ocrStats) error {
+	txtPath, hocrPath := ocrSidecars(doc.Path)
+	var text strings.Builder
+	var hocrPages []string
+	for p := 1; p <= doc.Pages; p++ {
+		b, err := os.ReadFile(doc.statePath(p, ".txt"))
+		if err != nil {
+			stats.add(func(s *ocrStats) { s.Incomplete++ })
+			return err
+		}
+		text.WriteString(normalizeText(string(b)))
+		text.WriteString("\n\f")
+		if h, err := os.ReadFile(doc.statePath(p, ".hocr")); err == nil {
+			hocrPages = append(hocrPages, renumberHOCR(string(h), p))
+		}
+	}
+	err := writeFileAtomic(txtPath, func(w io.Writer) error {
+		_, err := io.WriteString(w, text.String())
+		return err
+	})
+	if err == nil {
+		err = writeFileAtomic(hocrPath, func(w io.Writer) error {
+			_, err := io.WriteString(w, joinHOCR(hocrPages))
+			return err
+		})
+	}
+	if err != nil {
+		stats.add(func(s *ocrStats) { s.Incomplete++ })
+		return err
+	}
+	os.RemoveAll(doc.State)
+	stats.add(func(s *ocrStats) { s.Written++ })
+	return nil
+}
+
+var (
+	hocrIDs     = regexp.MustCompile(`(id=['"](?:page|block|par|line|word)_)1([_'"])`)
+	hocrPageNo  = regexp.MustCompile(`ppageno \d+`)
+	hocrBody    = regexp.MustCompile(`(?s)<body>(.*)</body>`)
+	hocrHeading = regexp.MustCompile(`(?s)^(.*<body>)`)
+)
+
+// renumberHOCR makes the ids and the page number of the hOCR of a single
+// image those of a page of the document.
+func renumberHOCR(hocr string, page int) string {
+	hocr = hocrIDs.ReplaceAllString(hocr, "${1}"+strconv.Itoa(page)+"${2}")
+	return hocrPageNo.ReplaceAllString(hocr, "ppageno "+strconv.Itoa(page-1))
+}
+
+// joinHOCR puts the pages of hOCR documents in the first one.
+func joinHOCR(pages []string) string {
+	if len(pages) == 0 {
+		return ""
+	}
+	head := hocrHeading.FindString(pages[0])
+	if head == "" {
+		return strings.Join(pages, "\n")
+	}
+	var b strings.Builder
+	b.WriteString(head)
+	for _, p := range pages {
+		if m := hocrBody.FindStringSubmatch(p); m != nil {
+			b.WriteString(m[1])
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// countUnfinished counts the documents an interrupted run left with
+// pages to do.
+func countUnfinished(queue []ocrJob) int {
+	seen := make(map[*ocrDoc]bool)
+	for _, job := range queue {
+		job.doc.mu.Lock()
+		if job.doc.remaining > 0 {
+			seen[job.doc] = true
+		}
+		job.doc.mu.Unlock()
+	}
+	return len(seen)
+}
+
+// ocrProgress draws a progress bar with the time left on the standard
+// error, when it is a terminal.
+type ocrProgress struct {
+	mu    sync.Mutex
+	total int
+	done  int
+	start time.Time
+	tty   bool
+}
+
+func newOCRProgress(total int) *ocrProgress {
+	p := &ocrProgress{total: total, start: time.Now(), tty: isTerminal(os.Stderr)}
+	p.draw()
+	return p
+}
+
+func (p *ocrProgress) step() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.draw()
+}
+
+// printf prints a line above the bar.
+func (p *ocrProgress) printf(format string, a ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	p.draw()
+}
+
+// draw is called with the lock held.
+func (p *ocrProgress) draw() {
+	if !p.tty || p.total == 0 {
+		return
+	}
+	const width = 30
+	filled := width * p.done / p.total
+	bar := spinnerStyle.Render(strings.Repeat("█", filled)) +
+		mutedStyle.Render(strings.Repeat("░", width-filled))
+	eta := "…"
+	if p.done > 0 {
+		left := time.Since(p.start) / time.Duration(p.done) * time.Duration(p.total-p.done)
+		eta = left.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s %d/%d pages, %d%%, %s left", bar, p.done, p.total, 100*p.done/p.total, eta)
+}
+
+func (p *ocrProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty && p.total > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (p *ocrProgress) elapsed() time.Duration {
+	return time.Since(p.start).Round(time.Second)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testHOCR is the hOCR tesseract writes for a single image.
+func testHOCR(word string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+ <head>
+  <title></title>
+  <meta name='ocr-system' content='tesseract 5.3.0' />
+ </head>
+ <body>
+  <div class='ocr_page' id='page_1' title='image "unknown"; bbox 0 0 100 50; ppageno 0'>
+   <div class='ocr_carea' id='block_1_1' title="bbox 10 10 90 40">
+    <p class='ocr_par' id='par_1_1' lang='eng'>
+     <span class='ocr_line' id='line_1_1' title="bbox 10 10 90 40">
+      <span class='ocrx_word' id='word_1_1' title='bbox 10 10 90 40; x_wconf 96'>` + word + `</span>
+     </span>
+    </p>
+   </div>
+  </div>
+ </body>
+</html>
+`
+}
+
+func TestRenumberHOCR(t *testing.T) {
+	got := renumberHOCR(testHOCR("Hello"), 12)
+	for _, want := range []string{"id='page_12'", "id='block_12_1'", "id='par_12_1'", "id='line_12_1'", "id='word_12_1'", "ppageno 11"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renumbered hOCR has no %s:\n%s", want, got)
+		}
+	}
+	for _, old := range []string{"_1_", "page_1'", "ppageno 0"} {
+		if strings.Contains(got, old) {
+			t.Errorf("renumbered hOCR still has %s", old)
+		}
+	}
+	// the words themselves are left alone, their quotes are escaped
+	if got := renumberHOCR(testHOCR("id=&#39;word_1_1&#39;"), 3); !strings.Contains(got, ">id=&#39;word_1_1&#39;<") {
+		t.Errorf("the text of a word was renumbered:\n%s", got)
+	}
+}
+
+func TestJoinHOCR(t *testing.T) {
+	if got := joinHOCR(nil); got != "" {
+		t.Errorf("joinHOCR(nil) = %q", got)
+	}
+	got := joinHOCR([]string{renumberHOCR(testHOCR("one"), 1), renumberHOCR(testHOCR("two"), 3)})
+	if n := strings.Count(got, "<body>"); n != 1 {
+		t.Errorf("%d bodies, want 1", n)
+	}
+	if n := strings.Count(got, "<html"); n != 1 {
+		t.Errorf("%d html elements, want 1", n)
+	}
+	one, two := strings.Index(got, "id='page_1'"), strings.Index(got, "id='page_3'")
+	if one < 0 || two < 0 || one > two {
+		t.Errorf("pages missing or out of order:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "</body>\n</html>\n") {
+		t.Errorf("joined hOCR does not end the document:\n%s", got)
+	}
+	// not hOCR, kept as is
+	if got := joinHOCR([]string{"a", "b"}); got != "a\nb" {
+		t.Errorf("joinHOCR of plain text = %q", got)
+	}
+}
+
+func TestFinishOCR(t *testing.T) {
+	dir := t.TempDir()
+	doc := &ocrDoc{Path: filepath.Join(dir, "book.pdf"), Pages: 2, State: filepath.Join(dir, ".book.pdf.ocr")}
+	if err := os.Mkdir(doc.State, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(doc.statePath(1, ".txt"), []byte("Text  \nof page one\n"), 0o644)
+	os.WriteFile(doc.statePath(2, ".txt"), []byte("Scanned"), 0o644)
+	os.WriteFile(doc.statePath(2, ".hocr"), []byte(testHOCR("Scanned")), 0o644)
+	// a text of the user next to the document
+	os.WriteFile(filepath.Join(dir, "book.txt"), []byte("my notes"), 0o644)
+
+	stats := &ocrStats{}
+	if err := finishOCR(doc, stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Written != 1 {
+		t.Errorf("%d documents written, want 1", stats.Written)
+	}
+	txtPath, hocrPath := ocrSidecars(doc.Path)
+	text, _ := os.ReadFile(txtPath)
+	if want := "Text\nof page one\n\fScanned\n\f"; string(text) != want {
+		t.Errorf("%s = %q, want %q", txtPath, text, want)
+	}
+	hocr, _ := os.ReadFile(hocrPath)
+	if !strings.Contains(string(hocr), "id='word_2_1'") {
+		t.Errorf("%s has no word of page 2:\n%s", hocrPath, hocr)
+	}
+	if notes, _ := os.ReadFile(filepath.Join(dir, "book.txt")); string(notes) != "my notes" {
+		t.Errorf("book.txt was replaced by %q", notes)
+	}
+	if _, err := os.Stat(doc.State); !os.IsNotExist(err) {
+		t.Errorf("the state of the document is left: %v", err)
+	}
+	// the PDF itself does not exist
+	if ocrUpToDate(doc.Path) {
+		t.Error("a missing document is up to date")
+	}
+}
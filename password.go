@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/ledongthuc/pdf"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+var (
+	errPasswordRequired = errors.New("this PDF is encrypted and needs a password")
+	errWrongPassword    = errors.New("the password is wrong for this PDF")
+)
+
+var (
+	passwordMu sync.Mutex
+	// passwords typed in the prompt, by absolute path
+	passwords = make(map[string]string)
+	// from --password or LUMUS_PDF_PASSWORD, tried on every encrypted PDF
+	defaultPassword string
+)
+
+func setPassword(path, password string) {
+	passwordMu.Lock()
+	defer passwordMu.Unlock()
+	passwords[path] = password
+}
+
+func passwordFor(path string) string {
+	passwordMu.Lock()
+	defer passwordMu.Unlock()
+	if password, ok := passwords[path]; ok {
+		return password
+	}
+	return defaultPassword
+}
+
+// openPDF opens a PDF with the ledongthuc reader, decrypting it with the
+// known password. Files encrypted with an empty user password open without
+// one.
+func openPDF(path string) (*os.File, *pdf.Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	password, tried := passwordFor(path), false
+	r, err := pdf.NewReaderEncrypted(f, fi.Size(), func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	if err != nil {
+		f.Close()
+		return nil, nil, passwordError(password, err)
+	}
+	return f, r, nil
+}
+
+// pdfcpuConfig returns a pdfcpu configuration carrying the password of
+// the document.
+func pdfcpuConfig(path string) *pdfmodel.Configuration {
+	pdfConf := pdfmodel.NewDefaultConfiguration()
+	password := passwordFor(path)
+	pdfConf.UserPW = password
+	pdfConf.OwnerPW = password
+	return pdfConf
+}
+
+// passwordError tells a missing password from a wrong one.
+func passwordError(password string, err error) error {
+	if !errors.Is(err, pdf.ErrInvalidPassword) && !errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return err
+	}
+	if password == "" {
+		return errPasswordRequired
+	}
+	return errWrongPassword
+}
+
+func isPasswordError(err error) bool {
+	return errors.Is(err, errPasswordRequired) || errors.Is(err, errWrongPassword)
+}
+
+func newPasswordInput() textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = "password"
+	ti.EchoMode = textinput.EchoPassword
+	ti.EchoCharacter = '•'
+	ti.Width = 30
+	return ti
+}
+
+// askPassword switches to the password prompt for the page that could not
+// be opened.
+func (m model) askPassword(msg LoadContentMsg, err error) (tea.Model, tea.Cmd) {
+	m.PasswordMode = true
+	m.PasswordErr = err
+	m.PasswordFor = msg
+	m.Loading = false
+	m.PasswordInput.Reset()
+	m.PasswordInput.Focus()
+	return m, textinput.Blink
+}
+
+func (m model) handlePasswordKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		setPassword(m.PasswordFor.FileName, m.PasswordInput.Value())
+		m.PasswordMode = false
+		m.PasswordInput.Blur()
+		m.Loading = true
+		load := m.PasswordFor
+		return m, func() tea.Msg { return load }
+	case "esc", "ctrl+c":
+		m.PasswordMode = false
+		m.PasswordInput.Blur()
+		m.ReadingMode = false
+		m.dropUnopenedTab()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.PasswordInput, cmd = m.PasswordInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) passwordView() string {
+	s := fmt.Sprintf("🔒 %s is encrypted.\n\nPassword:\n%s\n\n%s", filepath.Base(m.PasswordFor.FileName), m.PasswordInput.View(), mutedStyle.Render("(enter to open, esc to cancel)"))
+	if errors.Is(m.PasswordErr, errWrongPassword) {
+		s += "\n\n" + matchStyle.Render(" Wrong password, try again. ")
+	}
+	return helpBoxStyle.Render(s)
+}
@@ -10,7 +10,7 @@ echo "🚀 Preparando pacote para AUR..."
 # Criar tarball do código fonte
 echo "📦 Criando tarball do código fonte..."
 mkdir -p ${NAME}-${VERSION}
-cp lumus.go ${NAME}-${VERSION}/
+cp *.go ${NAME}-${VERSION}/
 if [ -f go.mod ]; then
     cp go.mod ${NAME}-${VERSION}/
 fi
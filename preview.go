@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// how long the selection must rest on a file before it is previewed
+const previewDelay = 150 * time.Millisecond
+
+// preview of a PDF shown next to the file list
+type preview struct {
+	Path   string
+	Title  string
+	Author string
+	Pages  int
+	Text   string
+	Err    error
+}
+
+// previewTickMsg fires once the selection stopped on Path. Only the tick
+// matching the latest Seq starts an extraction.
+type previewTickMsg struct {
+	Seq  int
+	Path string
+}
+
+// PreviewMsg carries a preview extracted in the background.
+type PreviewMsg struct {
+	Preview preview
+}
+
+// previewKey identifies a preview, the modification time makes a file
+// changed since it was previewed miss the cache.
+type previewKey struct {
+	Path    string
+	ModTime int64
+}
+
+// previews caches the previews of the files recently selected.
+var previews = newLRUCache[previewKey, preview](256)
+
+// schedulePreview starts the debounce timer when the selected file changed.
+func (m *model) schedulePreview() tea.Cmd {
+	path := ""
+	if i, ok := m.List.SelectedItem().(item); ok && !i.IsDir && !i.Broken {
+		path = i.path()
+	}
+	if path == m.PreviewTarget {
+		return nil
+	}
+	m.PreviewTarget = path
+	m.PreviewSeq++
+	if path == "" {
+		m.Preview = preview{}
+		return nil
+	}
+	seq := m.PreviewSeq
+	return tea.Tick(previewDelay, func(time.Time) tea.Msg {
+		return previewTickMsg{Seq: seq, Path: path}
+	})
+}
+
+func (m model) handlePreviewTickMsg(msg previewTickMsg) (tea.Model, tea.Cmd) {
+	if msg.Seq != m.PreviewSeq {
+		return m, nil
+	}
+	key := previewKey{Path: msg.Path}
+	if info, err := os.Stat(msg.Path); err == nil {
+		key.ModTime = info.ModTime().UnixNano()
+	}
+	if p, ok := previews.get(key); ok {
+		m.Preview = p
+		return m, nil
+	}
+	m.Preview = preview{Path: msg.Path}
+	return m, func() tea.Msg {
+		p := readPreview(msg.Path)
+		previews.put(key, p)
+		return PreviewMsg{Preview: p}
+	}
+}
+
+func (m model) handlePreviewMsg(msg PreviewMsg) (tea.Model, tea.Cmd) {
+	if msg.Preview.Path == m.PreviewTarget {
+		m.Preview = msg.Preview
+	}
+	return m, nil
+}
+
+// readPreview reads the metadata and the text of the first page with the
+// ledongthuc reader, fast enough to follow the selection.
+func readPreview(path string) (p preview) {
+	p.Path = path
+	defer func() {
+		if r := recover(); r != nil {
+			p.Err = fmt.Errorf("%v", r)
+		}
+	}()
+	f, r, err := openPDF(path)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+	defer f.Close()
+	info := r.Trailer().Key("Info")
+	p.Title = strings.TrimSpace(info.Key("Title").Text())
+	p.Author = strings.TrimSpace(info.Key("Author").Text())
+	p.Pages = r.NumPage()
+	p.Text = strings.Join(pageLines(r, 1), "\n")
+	return p
+}
+
+func (m model) handlePreviewKey() (tea.Model, tea.Cmd) {
+	if m.ReadingMode {
+		return m, nil
+	}
+	m.ShowPreview = !m.ShowPreview
+	m.PreviewTarget = ""
+	m.Preview = preview{}
+	return m, nil
+}
+
+// layoutBrowser gives the list the left half of the screen when the
+// preview is shown.
+func (m *model) layoutBrowser() {
+	width := screenWidth()
+	if m.ShowPreview {
+		width /= 2
+	}
+	if m.List.Width() != width {
+		m.List.SetWidth(width)
+	}
+}
+
+func (m model) previewView() string {
+	width := screenWidth() - m.List.Width() - 3
+	height := listHeight - 2
+	if width < 10 {
+		return ""
+	}
+	style := lipgloss.NewStyle().Width(width)
+	var b strings.Builder
+	switch {
+	case m.PreviewTarget == "":
+		b.WriteString(mutedStyle.Render("No preview"))
+	case m.Preview.Path != m.PreviewTarget:
+		b.WriteString(mutedStyle.Render("Loading preview…"))
+	case m.Preview.Err != nil:
+		b.WriteString(mutedStyle.Render("Cannot preview: " + m.Preview.Err.Error()))
+	default:
+		title := m.Preview.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		b.WriteString(titleStyle.Copy().MarginLeft(0).Render(title) + "\n")
+		if m.Preview.Author != "" {
+			b.WriteString(mutedStyle.Render("Author: "+m.Preview.Author) + "\n")
+		}
+		b.WriteString(mutedStyle.Render(fmt.Sprintf("Pages: %d", m.Preview.Pages)) + "\n\n")
+		text := m.Preview.Text
+		if strings.TrimSpace(text) == "" {
+			text = mutedStyle.Render("No text on the first page, it may be scanned.")
+		}
+		b.WriteString(textStyle(text))
+	}
+	lines := strings.Split(style.Render(b.String()), "\n")
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return previewBoxStyle.Render(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The control server lets an editor drive the reader through JSON-RPC 2.0
+// over a unix socket, one JSON object per line. The requests that change
+// the reader are sent to the program as messages, the ones that read it
+// are answered from the state the model publishes after every update.
+// Subscribers are notified of the page_changed and selection_changed
+// events.
+
+// rpc is the control server of --listen, nil without one.
+var rpc *rpcServer
+
+type rpcServer struct {
+	ln   net.Listener
+	path string
+	// set once the program runs
+	program *tea.Program
+
+	mu    sync.Mutex
+	state readerState
+	subs  map[*rpcConn]bool
+}
+
+// readerState is what the model tells the server about itself.
+type readerState struct {
+	Path             string
+	Page             int
+	TotalPages       int
+	ShowRunningLines bool
+	Width            int
+	// path of the entry selected in the browser
+	Selected string
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcNullID answers the requests whose id could not be read.
+var rpcNullID = json.RawMessage("null")
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// error codes of the JSON-RPC specification
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// listenRPC opens the socket of an address such as unix:/tmp/lumus.sock.
+// A socket left behind by a reader that died is replaced.
+func listenRPC(addr string) (*rpcServer, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("unsupported address %q, use unix:/path.sock", addr)
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another reader", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcServer{ln: ln, path: path, subs: make(map[*rpcConn]bool)}, nil
+}
+
+// serve accepts connections until the server is closed.
+func (s *rpcServer) serve(p *tea.Program) {
+	s.program = p
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &rpcConn{conn: conn, events: make(chan rpcResponse, 64)}
+		go c.writeEvents()
+		go s.handleConn(c)
+	}
+}
+
+func (s *rpcServer) close() {
+	s.ln.Close()
+	os.Remove(s.path)
+}
+
+// rpcConn is a client. The events go through a buffer, a client that
+// stops reading loses them rather than blocking the reader.
+type rpcConn struct {
+	conn   net.Conn
+	mu     sync.Mutex
+	events chan rpcResponse
+}
+
+func (c *rpcConn) write(r rpcResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.JSONRPC = "2.0"
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return json.NewEncoder(c.conn).Encode(r)
+}
+
+func (c *rpcConn) writeEvents() {
+	for e := range c.events {
+		if c.write(e) != nil {
+			return
+		}
+	}
+}
+
+func (s *rpcServer) handleConn(c *rpcConn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, c)
+		s.mu.Unlock()
+		close(c.events)
+		c.conn.Close()
+	}()
+	dec := json.NewDecoder(c.conn)
+	for {
+		var req rpcRequest
+		if err := dec.Decode(&req); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.write(rpcResponse{ID: rpcNullID, Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			}
+			return
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			id := req.ID
+			if id == nil {
+				id = rpcNullID
+			}
+			if c.write(rpcResponse{ID: id, Error: &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}}) != nil {
+				return
+			}
+			continue
+		}
+		result, rerr := s.call(c, req)
+		// notifications get no answer
+		if req.ID == nil {
+			continue
+		}
+		resp := rpcResponse{ID: req.ID, Result: result, Error: rerr}
+		if rerr == nil && result == nil {
+			resp.Result = true
+		}
+		if c.write(resp) != nil {
+			return
+		}
+	}
+}
+
+func (s *rpcServer) call(c *rpcConn, req rpcRequest) (any, *rpcError) {
+	var params struct {
+		Path  string `json:"path"`
+		Page  int    `json:"page"`
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+		Note  string `json:"note"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+	invalid := func(format string, a ...any) *rpcError {
+		return &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf(format, a...)}
+	}
+	s.mu.Lock()
+	state := s.state
+	s.mu.Unlock()
+	// the params hold paths and queries, which stay out of the log
+	log.Printf("rpc: %s", req.Method)
+
+	switch req.Method {
+	case "open":
+		if params.Path == "" {
+			return nil, invalid("path is required")
+		}
+		path, err := filepath.Abs(params.Path)
+		if err != nil {
+			return nil, invalid("%v", err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, invalid("%v", err)
+		}
+		s.program.Send(LoadContentMsg{FileName: path, Page: max(params.Page, 1), Open: true, Query: params.Query})
+		return nil, nil
+	case "goto_page":
+		if state.Path == "" {
+			return nil, invalid("no document is open")
+		}
+		if params.Page < 1 || params.Page > state.TotalPages {
+			return nil, invalid("page %d is not in 1-%d", params.Page, state.TotalPages)
+		}
+		// by path, the tab may have changed since
+		s.program.Send(LoadContentMsg{FileName: state.Path, Page: params.Page, Open: true})
+		return nil, nil
+	case "get_page":
+		if state.Path == "" {
+			return nil, invalid("no document is open")
+		}
+		text, _, err := readPDFPage(state.Path, state.Page, state.ShowRunningLines, state.Width)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return map[string]any{"path": state.Path, "page": state.Page, "total_pages": state.TotalPages, "text": text}, nil
+	case "get_selection":
+		return map[string]any{"path": state.Selected}, nil
+	case "search":
+		if params.Query == "" {
+			return nil, invalid("query is required")
+		}
+		if params.Limit <= 0 {
+			params.Limit = 20
+		}
+		results := openIndex().search(params.Query, params.Limit)
+		if results == nil {
+			results = []searchResult{}
+		}
+		return results, nil
+	case "add_bookmark":
+		path, page := state.Path, state.Page
+		if params.Path != "" {
+			var err error
+			if path, err = filepath.Abs(params.Path); err != nil {
+				return nil, invalid("%v", err)
+			}
+			page = params.Page
+		} else if params.Page > 0 {
+			page = params.Page
+		}
+		if path == "" || page < 1 {
+			return nil, invalid("path and page are required without an open document")
+		}
+		b := bookmark{Page: page, Note: params.Note, Added: time.Now()}
+		if err := history.addBookmark(path, b); err != nil {
+			return nil, &rpcError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return map[string]any{"path": path, "bookmark": b}, nil
+	case "bookmarks":
+		path := state.Path
+		if params.Path != "" {
+			path, _ = filepath.Abs(params.Path)
+		}
+		doc, _ := history.get(path)
+		if doc.Bookmarks == nil {
+			return []bookmark{}, nil
+		}
+		return doc.Bookmarks, nil
+	case "subscribe":
+		s.mu.Lock()
+		s.subs[c] = true
+		s.mu.Unlock()
+		return nil, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "unknown method " + req.Method}
+}
+
+// observe takes the state of the model after an update and notifies the
+// subscribers of what changed.
+func (s *rpcServer) observe(state readerState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.state
+	s.state = state
+	var events []rpcResponse
+	if state.Path != "" && (state.Path != prev.Path || state.Page != prev.Page) {
+		events = append(events, rpcResponse{Method: "page_changed", Params: map[string]any{"path": state.Path, "page": state.Page, "total_pages": state.TotalPages}})
+	}
+	if state.Selected != prev.Selected {
+		events = append(events, rpcResponse{Method: "selection_changed", Params: map[string]any{"path": state.Selected}})
+	}
+	for c := range s.subs {
+		for _, e := range events {
+			select {
+			case c.events <- e:
+			default:
+			}
+		}
+	}
+}
+
+// readerState is published to the control server after every update.
+func (m model) readerState() readerState {
+	var state readerState
+	if i, ok := m.List.SelectedItem().(item); ok {
+		state.Selected = i.path()
+	}
+	if len(m.Tabs) == 0 || m.Content == "" {
+		return state
+	}
+	state.Path = m.FileName
+	state.Page = m.visiblePage()
+	state.TotalPages = m.TotalPages
+	state.ShowRunningLines = m.ShowRunningLines
+	state.Width = m.textWidth()
+	return state
+}
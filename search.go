@@ -0,0 +1,537 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// indexedDoc is the text of a document as it was indexed.
+type indexedDoc struct {
+	Size    int64
+	ModTime time.Time
+	// text of every page, to check phrases and cut snippets
+	Pages []string
+}
+
+// posting is a page holding a term Count times.
+type posting struct {
+	Path  string
+	Page  int
+	Count int
+}
+
+// searchIndex is an inverted index of the pages of the library documents,
+// saved with gob in the data directory.
+type searchIndex struct {
+	mu    sync.Mutex
+	path  string
+	Docs  map[string]*indexedDoc
+	Terms map[string][]posting
+	// the terms in order, for prefix queries, nil when out of date
+	sorted []string
+}
+
+// indexStats counts what an update changed.
+type indexStats struct {
+	Indexed, Removed, Failed int
+}
+
+func (s indexStats) String() string {
+	return fmt.Sprintf("%d indexed, %d removed, %d failed", s.Indexed, s.Removed, s.Failed)
+}
+
+var (
+	indexOnce sync.Once
+	index     *searchIndex
+)
+
+// openIndex loads the index the first time it is needed, it can be large.
+func openIndex() *searchIndex {
+	indexOnce.Do(func() {
+		index = loadIndex(indexPath())
+	})
+	return index
+}
+
+func indexPath() string {
+	dir := dataDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "index.gob")
+}
+
+// loadIndex reads the index file, a missing or unreadable file gives an
+// empty index that the next update fills.
+func loadIndex(path string) *searchIndex {
+	idx := &searchIndex{path: path, Docs: make(map[string]*indexedDoc), Terms: make(map[string][]posting)}
+	if path == "" {
+		return idx
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return idx
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(idx); err != nil || idx.Docs == nil || idx.Terms == nil {
+		idx.Docs = make(map[string]*indexedDoc)
+		idx.Terms = make(map[string][]posting)
+	}
+	return idx
+}
+
+// save writes the index, the caller holds the lock.
+func (idx *searchIndex) save() error {
+	if idx.path == "" {
+		return errors.New("no data directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return writeFileAtomic(idx.path, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(idx)
+	})
+}
+
+// update indexes the library documents that are new or changed since the
+// last update and drops the ones that left the library. Pages go through
+// the same extraction as the reader, OCR included, so the first update of
+// a large library takes a while.
+func (idx *searchIndex) update(docs []libraryDoc) (indexStats, error) {
+	var stats indexStats
+	inLibrary := make(map[string]bool, len(docs))
+	for _, d := range docs {
+		inLibrary[d.Path] = true
+	}
+
+	idx.mu.Lock()
+	for path := range idx.Docs {
+		if !inLibrary[path] {
+			idx.remove(path)
+			stats.Removed++
+		}
+	}
+	idx.mu.Unlock()
+
+	// save every few documents so that an interrupted update is not lost
+	const saveEvery = 10
+	pending := 0
+	for _, d := range docs {
+		info, err := os.Stat(d.Path)
+		if err != nil {
+			stats.Failed++
+			continue
+		}
+		idx.mu.Lock()
+		old, ok := idx.Docs[d.Path]
+		idx.mu.Unlock()
+		if ok && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		doc, err := extractDoc(d.Path, info)
+		if err != nil {
+			stats.Failed++
+			continue
+		}
+		idx.mu.Lock()
+		idx.remove(d.Path)
+		idx.add(d.Path, doc)
+		pending++
+		if pending == saveEvery {
+			err = idx.save()
+			pending = 0
+		}
+		idx.mu.Unlock()
+		if err != nil {
+			return stats, err
+		}
+		stats.Indexed++
+	}
+
+	if pending == 0 && stats.Removed == 0 {
+		return stats, nil
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return stats, idx.save()
+}
+
+// extractDoc reads every page without wrapping nor running lines.
+func extractDoc(path string, info fs.FileInfo) (*indexedDoc, error) {
+	pages, err := readPages(path)
+	if err != nil {
+		return nil, err
+	}
+	return &indexedDoc{Size: info.Size(), ModTime: info.ModTime(), Pages: pages}, nil
+}
+
+// readPages extracts the text of every page, unwrapped. A page that
+// cannot be read is left empty.
+func readPages(path string) ([]string, error) {
+	text, total, err := readPDFPage(path, 1, false, 0)
+	if total == 0 {
+		if err == nil {
+			err = errors.New("no pages")
+		}
+		return nil, err
+	}
+	pages := make([]string, total)
+	for page := 1; page <= total; page++ {
+		if page > 1 {
+			text, _, err = readPDFPage(path, page, false, 0)
+		}
+		if err == nil {
+			pages[page-1] = text
+		}
+	}
+	return pages, nil
+}
+
+// add indexes a document, the caller holds the lock.
+func (idx *searchIndex) add(path string, doc *indexedDoc) {
+	idx.Docs[path] = doc
+	for i, text := range doc.Pages {
+		counts := make(map[string]int)
+		for _, w := range wordSpans(text) {
+			counts[w.Key]++
+		}
+		for term, count := range counts {
+			idx.Terms[term] = append(idx.Terms[term], posting{Path: path, Page: i + 1, Count: count})
+		}
+	}
+	idx.sorted = nil
+}
+
+// remove drops a document, the caller holds the lock.
+func (idx *searchIndex) remove(path string) {
+	if _, ok := idx.Docs[path]; !ok {
+		return
+	}
+	delete(idx.Docs, path)
+	for term, postings := range idx.Terms {
+		kept := postings[:0]
+		for _, p := range postings {
+			if p.Path != path {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.Terms, term)
+		} else {
+			idx.Terms[term] = kept
+		}
+	}
+	idx.sorted = nil
+}
+
+// word is a word of a text, by byte offsets, with its search key.
+type word struct {
+	Start, End int
+	Key        string
+}
+
+// wordSpans splits a text in words: runs of letters and digits.
+func wordSpans(text string) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			words = append(words, word{Start: start, End: i, Key: foldTerm(text[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{Start: start, End: len(text), Key: foldTerm(text[start:])})
+	}
+	return words
+}
+
+// foldTerm lowercases a word and drops its accents, so "Ação" matches
+// "acao".
+func foldTerm(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// queryClause is a word, a "quoted phrase" or a prefix* of a query. Every
+// clause must match a page for it to be a result.
+type queryClause struct {
+	Terms []string
+	// the last term is a prefix
+	Prefix bool
+}
+
+// parseQuery splits a query in clauses: quoted text is a phrase and a
+// trailing * makes a prefix.
+func parseQuery(q string) []queryClause {
+	var clauses []queryClause
+	// words such as "e-mail" are phrases of their parts
+	addClause := func(text string) {
+		var terms []string
+		for _, w := range wordSpans(text) {
+			terms = append(terms, w.Key)
+		}
+		if len(terms) > 0 {
+			clauses = append(clauses, queryClause{Terms: terms, Prefix: strings.HasSuffix(text, "*")})
+		}
+	}
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			addClause(part)
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			addClause(field)
+		}
+	}
+	return clauses
+}
+
+// matches reports whether the words from i on match the clause.
+func (c queryClause) matches(words []word, i int) bool {
+	if i+len(c.Terms) > len(words) {
+		return false
+	}
+	for j, term := range c.Terms {
+		key := words[i+j].Key
+		if c.Prefix && j == len(c.Terms)-1 {
+			if !strings.HasPrefix(key, term) {
+				return false
+			}
+		} else if key != term {
+			return false
+		}
+	}
+	return true
+}
+
+// searchResult is a page matching a query.
+type searchResult struct {
+	Path    string  `json:"path"`
+	Page    int     `json:"page"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+type pageRef struct {
+	Path string
+	Page int
+}
+
+// search returns the pages matching every clause of the query, best
+// first. Pages score higher for rare terms found many times (tf-idf).
+func (idx *searchIndex) search(q string, limit int) []searchResult {
+	clauses := parseQuery(q)
+	if len(clauses) == 0 {
+		return nil
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	totalPages := 0
+	for _, d := range idx.Docs {
+		totalPages += len(d.Pages)
+	}
+
+	var scores map[pageRef]float64
+	for _, c := range clauses {
+		clauseScores := idx.clauseScores(c, totalPages)
+		if scores == nil {
+			scores = clauseScores
+			continue
+		}
+		for ref, score := range scores {
+			if s, ok := clauseScores[ref]; ok {
+				scores[ref] = score + s
+			} else {
+				delete(scores, ref)
+			}
+		}
+	}
+
+	results := make([]searchResult, 0, len(scores))
+	for ref, score := range scores {
+		results = append(results, searchResult{Path: ref.Path, Page: ref.Page, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Page < b.Page
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		r := &results[i]
+		r.Snippet = snippet(idx.Docs[r.Path].Pages[r.Page-1], clauses)
+	}
+	return results
+}
+
+// clauseScores scores the pages matching one clause, the caller holds the
+// lock.
+func (idx *searchIndex) clauseScores(c queryClause, totalPages int) map[pageRef]float64 {
+	// pages holding every term, counting the occurrences of the last
+	// one, expanded when it is a prefix
+	var candidates map[pageRef]int
+	for i, term := range c.Terms {
+		terms := []string{term}
+		if c.Prefix && i == len(c.Terms)-1 {
+			terms = idx.withPrefix(term)
+		}
+		found := make(map[pageRef]int)
+		for _, t := range terms {
+			for _, p := range idx.Terms[t] {
+				found[pageRef{p.Path, p.Page}] += p.Count
+			}
+		}
+		if candidates != nil {
+			for ref := range found {
+				if _, ok := candidates[ref]; !ok {
+					delete(found, ref)
+				}
+			}
+		}
+		candidates = found
+	}
+
+	scores := make(map[pageRef]float64, len(candidates))
+	idf := math.Log(1 + float64(totalPages)/float64(len(candidates)+1))
+	for ref, count := range candidates {
+		if len(c.Terms) > 1 {
+			// the terms are on the page, check they follow each other
+			count = 0
+			words := wordSpans(idx.Docs[ref.Path].Pages[ref.Page-1])
+			for i := range words {
+				if c.matches(words, i) {
+					count++
+				}
+			}
+			if count == 0 {
+				continue
+			}
+		}
+		scores[ref] = (1 + math.Log(float64(count))) * idf
+	}
+	return scores
+}
+
+// withPrefix returns the indexed terms starting with prefix, the caller
+// holds the lock.
+func (idx *searchIndex) withPrefix(prefix string) []string {
+	if idx.sorted == nil {
+		idx.sorted = make([]string, 0, len(idx.Terms))
+		for term := range idx.Terms {
+			idx.sorted = append(idx.sorted, term)
+		}
+		sort.Strings(idx.sorted)
+	}
+	var terms []string
+	for i := sort.SearchStrings(idx.sorted, prefix); i < len(idx.sorted) && strings.HasPrefix(idx.sorted[i], prefix); i++ {
+		terms = append(terms, idx.sorted[i])
+	}
+	return terms
+}
+
+// snippetWidth is the number of bytes of context kept on each side of the
+// first match.
+const snippetWidth = 60
+
+// snippet cuts the text around the first match of a clause, on one line.
+func snippet(text string, clauses []queryClause) string {
+	words := wordSpans(text)
+	start, end := 0, 0
+	for i := range words {
+		if c, ok := matchAt(clauses, words, i); ok {
+			start, end = words[i].Start, words[i+len(c.Terms)-1].End
+			break
+		}
+	}
+	from, to := start-snippetWidth, end+snippetWidth
+	prefix, suffix := "…", "…"
+	if from <= 0 {
+		from, prefix = 0, ""
+	}
+	if to >= len(text) {
+		to, suffix = len(text), ""
+	}
+	// move to rune boundaries
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+	return prefix + strings.Join(strings.Fields(text[from:to]), " ") + suffix
+}
+
+// matchAt returns the clause matching the words from i on.
+func matchAt(clauses []queryClause, words []word, i int) (queryClause, bool) {
+	for _, c := range clauses {
+		if c.matches(words, i) {
+			return c, true
+		}
+	}
+	return queryClause{}, false
+}
+
+// highlightMatches styles the words of the text matching the query and
+// returns the line of the first match, -1 when there is none.
+func highlightMatches(text string, clauses []queryClause) (string, int) {
+	words := wordSpans(text)
+	var b strings.Builder
+	last, firstLine := 0, -1
+	for i := 0; i < len(words); i++ {
+		c, ok := matchAt(clauses, words, i)
+		if !ok {
+			continue
+		}
+		start, end := words[i].Start, words[i+len(c.Terms)-1].End
+		if firstLine < 0 {
+			firstLine = strings.Count(text[:start], "\n")
+		}
+		b.WriteString(text[last:start])
+		// style line by line, a phrase can span lines
+		lines := strings.Split(text[start:end], "\n")
+		for j, line := range lines {
+			if j > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(matchStyle.Render(line))
+		}
+		last = end
+		i += len(c.Terms) - 1
+	}
+	b.WriteString(text[last:])
+	return b.String(), firstLine
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []queryClause
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"rust", []queryClause{{Terms: []string{"rust"}}}},
+		{"Rust  Ação", []queryClause{{Terms: []string{"rust"}}, {Terms: []string{"acao"}}}},
+		{`"borrow checker" rules`, []queryClause{{Terms: []string{"borrow", "checker"}}, {Terms: []string{"rules"}}}},
+		{"lifetim*", []queryClause{{Terms: []string{"lifetim"}, Prefix: true}}},
+		{`"memory saf*"`, []queryClause{{Terms: []string{"memory", "saf"}, Prefix: true}}},
+		{"e-mail", []queryClause{{Terms: []string{"e", "mail"}}}},
+		// an unterminated quote runs to the end
+		{`"open phrase`, []queryClause{{Terms: []string{"open", "phrase"}}}},
+		{`-- * ""`, nil},
+	}
+	for _, tt := range tests {
+		if got := parseQuery(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQuery(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHighlightMatches(t *testing.T) {
+	saved := matchStyle
+	defer func() { matchStyle = saved }()
+	matchStyle = lipgloss.NewStyle().Transform(func(s string) string { return "[" + s + "]" })
+
+	tests := []struct {
+		text, query string
+		want        string
+		line        int
+	}{
+		{"nothing here", "rust", "nothing here", -1},
+		{"Rust is rust", "rust", "[Rust] is [rust]", 0},
+		{"one\ntwo Ação", "acao", "one\ntwo [Ação]", 1},
+		{"trust rusty rust", "rust*", "trust [rusty] [rust]", 0},
+		{"the borrow\nchecker", `"borrow checker"`, "the [borrow]\n[checker]", 0},
+		{"borrow the checker", `"borrow checker"`, "borrow the checker", -1},
+		{"a b a", "a b", "[a] [b] [a]", 0},
+	}
+	for _, tt := range tests {
+		got, line := highlightMatches(tt.text, parseQuery(tt.query))
+		if got != tt.want || line != tt.line {
+			t.Errorf("highlightMatches(%q, %q) = %q, %d, want %q, %d", tt.text, tt.query, got, line, tt.want, tt.line)
+		}
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := &searchIndex{Docs: make(map[string]*indexedDoc), Terms: make(map[string][]posting)}
+	idx.add("a.pdf", &indexedDoc{Pages: []string{
+		"rust rust rust and some ownership",
+		"rust once, the borrow checker",
+		"common words only",
+	}})
+	idx.add("b.pdf", &indexedDoc{Pages: []string{
+		"rust and the checker borrow",
+		"common words and rustacean",
+	}})
+
+	pages := func(results []searchResult) []pageRef {
+		var refs []pageRef
+		for _, r := range results {
+			refs = append(refs, pageRef{r.Path, r.Page})
+		}
+		return refs
+	}
+	tests := []struct {
+		query string
+		want  []pageRef
+	}{
+		// more occurrences first, ties by path and page
+		{"rust", []pageRef{{"a.pdf", 1}, {"a.pdf", 2}, {"b.pdf", 1}}},
+		// every clause must match
+		{"rust ownership", []pageRef{{"a.pdf", 1}}},
+		// the words of a phrase must follow each other
+		{`"borrow checker"`, []pageRef{{"a.pdf", 2}}},
+		{"rust*", []pageRef{{"a.pdf", 1}, {"a.pdf", 2}, {"b.pdf", 1}, {"b.pdf", 2}}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := pages(idx.search(tt.query, 0)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// a rare term weighs more than a common one
+	rare := idx.search("ownership", 0)
+	common := idx.search("common", 0)
+	if len(rare) != 1 || len(common) != 2 || rare[0].Score <= common[0].Score {
+		t.Errorf("rare term scores %v, common term %v", rare, common)
+	}
+	if got := idx.search("rust", 2); len(got) != 2 {
+		t.Errorf("search with a limit of 2 returned %d results", len(got))
+	}
+	if got := idx.search("ownership", 0)[0].Snippet; got != "rust rust rust and some ownership" {
+		t.Errorf("snippet = %q", got)
+	}
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/otiai10/gosseract/v2"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A searchable PDF is the scanned one with the words found by tesseract
+// written over the scans in rendering mode 3, which draws nothing. The
+// scans are left as they are: the content of the page is followed by the
+// text and everything else is written back byte for byte.
+
+// ocrFontName is the resource name of the font of the text layer.
+const ocrFontName = "LumusOCR"
+
+// ocrWord is a word of a page with its box in page units.
+type ocrWord struct {
+	Text                     string
+	Left, Bottom, Right, Top float64
+}
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n, m applied first.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// imagePlacements finds where the images of a content stream are drawn:
+// the matrix mapping the unit square of each image, by resource name.
+func imagePlacements(content []byte) map[string]matrix {
+	placed := make(map[string]matrix)
+	ctm := identity
+	var stack []matrix
+	var operands []string
+	for _, tok := range contentTokens(content) {
+		switch tok {
+		case "q":
+			stack = append(stack, ctm)
+		case "Q":
+			if n := len(stack); n > 0 {
+				ctm, stack = stack[n-1], stack[:n-1]
+			}
+		case "cm":
+			if n := len(operands); n >= 6 {
+				var m matrix
+				for i := range m {
+					m[i], _ = strconv.ParseFloat(operands[n-6+i], 64)
+				}
+				ctm = m.mul(ctm)
+			}
+		case "Do":
+			if n := len(operands); n > 0 && strings.HasPrefix(operands[n-1], "/") {
+				name := operands[n-1][1:]
+				if _, ok := placed[name]; !ok {
+					placed[name] = ctm
+				}
+			}
+		}
+		if isOperator(tok) {
+			operands = operands[:0]
+		} else {
+			operands = append(operands, tok)
+		}
+	}
+	return placed
+}
+
+func isOperator(tok string) bool {
+	c := tok[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '\'' || c == '"'
+}
+
+// contentTokens splits a content stream into numbers, names and
+// operators. Strings, arrays, dictionaries and inline images are dropped,
+// they take no part in placing images.
+func contentTokens(content []byte) []string {
+	var toks []string
+	s := string(content)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0:
+			i++
+		case c == '%':
+			for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			depth := 0
+			for ; i < len(s); i++ {
+				if s[i] == '\\' {
+					i++
+				} else if s[i] == '(' {
+					depth++
+				} else if s[i] == ')' {
+					if depth--; depth == 0 {
+						i++
+						break
+					}
+				}
+			}
+			toks = append(toks, "()")
+		case c == '<' && i+1 < len(s) && s[i+1] == '<', c == '>' && i+1 < len(s) && s[i+1] == '>':
+			i += 2
+		case c == '<':
+			for i < len(s) && s[i] != '>' {
+				i++
+			}
+			i++
+			toks = append(toks, "<>")
+		case c == '[' || c == ']' || c == '{' || c == '}' || c == '>':
+			i++
+		default:
+			j := i + 1
+			for j < len(s) && !strings.ContainsRune(" \n\r\t\f\x00()<>[]{}/%", rune(s[j])) {
+				j++
+			}
+			tok := s[i:j]
+			i = j
+			toks = append(toks, tok)
+			if tok == "ID" {
+				// inline image data up to EI
+				if k := strings.Index(s[i:], "EI"); k >= 0 {
+					i += k + 2
+				}
+			}
+		}
+	}
+	return toks
+}
+
+// ocrWords reads the words of a scan with their boxes in pixels.
+func ocrWords(data []byte) ([]gosseract.BoundingBox, error) {
+	client := ocrClients.get()
+	defer ocrClients.put(client)
+	if err := client.SetImageFromBytes(data); err != nil {
+		return nil, err
+	}
+	return client.GetBoundingBoxes(gosseract.RIL_WORD)
+}
+
+// scannedPage is a page to put text on: the biggest image of a page with
+// no fonts, where it is drawn and its words.
+type scannedPage struct {
+	Page          int
+	Image         string
+	Width, Height int
+	Data          []byte
+	Words         []gosseract.BoundingBox
+	Err           error
+	// why the scan can't be read, the page is then left without text
+	Skipped string
+}
+
+// findScans extracts the scans of the pages that have images and no
+// fonts.
+func findScans(path string) ([]*scannedPage, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	pdfConf := pdfcpuConfig(path)
+	pdfConf.Cmd = pdfmodel.EXTRACTIMAGES
+	ctx, err := api.ReadValidateAndOptimize(f, pdfConf)
+	if err != nil {
+		return nil, 0, passwordError(pdfConf.UserPW, err)
+	}
+	var scans []*scannedPage
+	for p := 1; p <= ctx.PageCount; p++ {
+		if len(pdfcpu.FontObjNrs(ctx, p)) > 0 || len(pdfcpu.ImageObjNrs(ctx, p)) == 0 {
+			continue
+		}
+		scan, err := pageScan(ctx, p)
+		if err != nil {
+			return nil, 0, err
+		}
+		if scan != nil {
+			scans = append(scans, scan)
+		}
+	}
+	return scans, ctx.PageCount, nil
+}
+
+// pageScan finds the biggest image of page p. pdfcpu can't decode every
+// kind of image, such as JBIG2 and CCITT faxes: the scan is then skipped.
+func pageScan(ctx *pdfmodel.Context, p int) (*scannedPage, error) {
+	images, err := pdfcpu.ExtractPageImages(ctx, p, false)
+	if err != nil {
+		return nil, err
+	}
+	names, err := pageImageNames(ctx.XRefTable, p)
+	if err != nil {
+		return nil, err
+	}
+	var scan *scannedPage
+	for _, objNr := range pdfcpu.ImageObjNrs(ctx, p) {
+		obj, ok := ctx.Optimize.ImageObjects[objNr]
+		if !ok || obj.ImageDict == nil {
+			continue
+		}
+		w, h := obj.ImageDict.IntEntry("Width"), obj.ImageDict.IntEntry("Height")
+		if w == nil || h == nil || (scan != nil && *w**h <= scan.Width*scan.Height) {
+			continue
+		}
+		scan = &scannedPage{Page: p, Image: names[objNr], Width: *w, Height: *h}
+		img, ok := images[objNr]
+		if !ok || img.Reader == nil {
+			scan.Skipped = "cannot decode the scan"
+			if n := len(obj.ImageDict.FilterPipeline); n > 0 {
+				scan.Skipped = "cannot decode the " + obj.ImageDict.FilterPipeline[n-1].Name + " scan"
+			}
+			continue
+		}
+		if scan.Data, err = io.ReadAll(img); err != nil {
+			scan.Skipped = err.Error()
+		}
+	}
+	return scan, nil
+}
+
+// pageImageNames maps the images of the resources of page p to their
+// names there. An image shared by pages may have another name on each.
+func pageImageNames(xt *pdfmodel.XRefTable, p int) (map[int]string, error) {
+	page, _, inherited, err := xt.PageDict(p, false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := xt.DereferenceDict(page["Resources"])
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		res = inherited.Resources
+	}
+	xobjects, err := xt.DereferenceDict(res["XObject"])
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string)
+	for name, v := range xobjects {
+		ref, ok := v.(types.IndirectRef)
+		if !ok {
+			continue
+		}
+		// the first name in order when the page has the image twice
+		if prev, ok := names[ref.ObjectNumber.Value()]; !ok || name < prev {
+			names[ref.ObjectNumber.Value()] = name
+		}
+	}
+	return names, nil
+}
+
+// runSearchable writes a copy of a scanned PDF with an invisible text
+// layer: lumus searchable scan.pdf [-o out.pdf] [--jobs 4]
+func runSearchable(args []string) error {
+	fs := flag.NewFlagSet("searchable", flag.ContinueOnError)
+	out := fs.String("o", "", "Output file (default name-searchable.pdf)")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Pages read at the same time")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 || *jobs < 1 {
+		return errors.New("usage: lumus searchable scan.pdf [-o out.pdf] [--jobs 4]")
+	}
+	path := files[0]
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + "-searchable.pdf"
+	}
+	if same, _ := samePath(path, *out); same {
+		return errors.New("the output would replace the scan, choose another name")
+	}
+
+	found, total, err := findScans(path)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("%s has no scanned pages", path)
+	}
+	var scans []*scannedPage
+	skipped := 0
+	for _, scan := range found {
+		if scan.Skipped != "" {
+			fmt.Fprintf(os.Stderr, "page %d: %s, skipped\n", scan.Page, scan.Skipped)
+			skipped++
+			continue
+		}
+		scans = append(scans, scan)
+	}
+	if len(scans) == 0 {
+		return errors.New("no scan could be decoded, nothing written")
+	}
+
+	ocrClients.setSize(*jobs)
+	bar := newOCRProgress(len(scans))
+	var wg sync.WaitGroup
+	next := make(chan *scannedPage)
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for scan := range next {
+				scan.Words, scan.Err = ocrWords(scan.Data)
+				scan.Data = nil
+				if scan.Err != nil {
+					bar.printf("page %d: %v", scan.Page, scan.Err)
+				}
+				bar.step()
+			}
+		}()
+	}
+	for _, scan := range scans {
+		next <- scan
+	}
+	close(next)
+	wg.Wait()
+	bar.finish()
+
+	failed := 0
+	for _, scan := range scans {
+		if scan.Err != nil {
+			failed++
+		}
+	}
+	if failed == len(scans) {
+		return errors.New("no page could be read, nothing written")
+	}
+	words, err := writeSearchable(path, *out, scans)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s: %d words on %d of %d pages", *out, words, len(scans)-failed, total)
+	if skipped > 0 {
+		fmt.Printf(", %d scans skipped", skipped)
+	}
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d pages could not be read and have no text", failed)
+	}
+	return nil
+}
+
+func samePath(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ai, bi), nil
+}
+
+// writeSearchable adds the text layers to a fresh read of the PDF, not to
+// the optimized one the scans came from, so that the rest is written
+// back unchanged.
+func writeSearchable(path, out string, scans []*scannedPage) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	pdfConf := pdfcpuConfig(path)
+	ctx, err := api.ReadAndValidate(f, pdfConf)
+	if err != nil {
+		return 0, passwordError(pdfConf.UserPW, err)
+	}
+	font, err := addOCRFont(ctx.XRefTable)
+	if err != nil {
+		return 0, err
+	}
+	words := 0
+	for _, scan := range scans {
+		if scan.Err != nil {
+			continue
+		}
+		n, err := addTextLayer(ctx.XRefTable, scan, font)
+		if err != nil {
+			return 0, fmt.Errorf("page %d: %w", scan.Page, err)
+		}
+		words += n
+	}
+	err = writeFileAtomic(out, func(w io.Writer) error {
+		return api.WriteContext(ctx, w)
+	})
+	return words, err
+}
+
+// addOCRFont adds a font without glyphs whose codes are the Unicode code
+// points, every glyph half an em wide. Drawn in mode 3 it needs no font
+// program, only the map back to Unicode for search and copy.
+func addOCRFont(xt *pdfmodel.XRefTable) (*types.IndirectRef, error) {
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// at most 100 ranges a block, and a range can't cross a high byte
+	for hi := 0; hi < 256; hi += 64 {
+		fmt.Fprintf(&cmap, "%d beginbfrange\n", 64)
+		for b := hi; b < hi+64; b++ {
+			fmt.Fprintf(&cmap, "<%02X00> <%02XFF> <%02X00>\n", b, b, b)
+		}
+		cmap.WriteString("endbfrange\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	sd, err := xt.NewStreamDictForBuf([]byte(cmap.String()))
+	if err != nil {
+		return nil, err
+	}
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	toUnicode, err := xt.IndRefForNewObject(*sd)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := xt.IndRefForNewObject(types.Dict{
+		"Type":        types.Name("FontDescriptor"),
+		"FontName":    types.Name("GlyphLessFont"),
+		"Flags":       types.Integer(5),
+		"FontBBox":    types.NewIntegerArray(0, 0, 500, 1000),
+		"ItalicAngle": types.Integer(0),
+		"Ascent":      types.Integer(1000),
+		"Descent":     types.Integer(0),
+		"CapHeight":   types.Integer(1000),
+		"StemV":       types.Integer(80),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cidFont, err := xt.IndRefForNewObject(types.Dict{
+		"Type":     types.Name("Font"),
+		"Subtype":  types.Name("CIDFontType2"),
+		"BaseFont": types.Name("GlyphLessFont"),
+		"CIDSystemInfo": types.Dict{
+			"Registry":   types.StringLiteral("Adobe"),
+			"Ordering":   types.StringLiteral("Identity"),
+			"Supplement": types.Integer(0),
+		},
+		"FontDescriptor": *descriptor,
+		"DW":             types.Integer(500),
+		"CIDToGIDMap":    types.Name("Identity"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return xt.IndRefForNewObject(types.Dict{
+		"Type":            types.Name("Font"),
+		"Subtype":         types.Name("Type0"),
+		"BaseFont":        types.Name("GlyphLessFont"),
+		"Encoding":        types.Name("Identity-H"),
+		"DescendantFonts": types.Array{*cidFont},
+		"ToUnicode":       *toUnicode,
+	})
+}
+
+// addTextLayer writes the words of a scan over it. The content of the
+// page is wrapped in q and Q so that the text is placed in page space
+// whatever state the scan left, the scan itself is only referred to.
+func addTextLayer(xt *pdfmodel.XRefTable, scan *scannedPage, font *types.IndirectRef) (int, error) {
+	page, _, inherited, err := xt.PageDict(scan.Page, false)
+	if err != nil {
+		return 0, err
+	}
+	content, err := xt.PageContent(page)
+	if err != nil {
+		return 0, err
+	}
+	place, ok := imagePlacements(content)[scan.Image]
+	if !ok {
+		// drawn through a form, assume the scan covers the page
+		box := inherited.MediaBox
+		if inherited.CropBox != nil {
+			box = inherited.CropBox
+		}
+		if box == nil {
+			return 0, errors.New("no page size")
+		}
+		place = matrix{box.Width(), 0, 0, box.Height(), box.LL.X, box.LL.Y}
+	}
+
+	var words []ocrWord
+	for _, b := range scan.Words {
+		text := strings.TrimSpace(b.Word)
+		if text == "" {
+			continue
+		}
+		// corners of the box from the top left of the image to page space
+		w := ocrWord{Text: text, Left: math.Inf(1), Bottom: math.Inf(1), Right: math.Inf(-1), Top: math.Inf(-1)}
+		for _, px := range []int{b.Box.Min.X, b.Box.Max.X} {
+			for _, py := range []int{b.Box.Min.Y, b.Box.Max.Y} {
+				x, y := place.apply(float64(px)/float64(scan.Width), 1-float64(py)/float64(scan.Height))
+				w.Left, w.Right = math.Min(w.Left, x), math.Max(w.Right, x)
+				w.Bottom, w.Top = math.Min(w.Bottom, y), math.Max(w.Top, y)
+			}
+		}
+		words = append(words, w)
+	}
+	if len(words) == 0 {
+		return 0, nil
+	}
+
+	if err := addPageFont(xt, page, inherited, font); err != nil {
+		return 0, err
+	}
+	// one stream rather than an array of them, which some readers ignore
+	contents, err := newContentStream(xt, "q\n"+string(content)+"\nQ\n"+textLayer(words))
+	if err != nil {
+		return 0, err
+	}
+	page["Contents"] = *contents
+	return len(words), nil
+}
+
+// textLayer draws every word in its box, sized to its height and
+// stretched to its width, then a space.
+func textLayer(words []ocrWord) string {
+	var b strings.Builder
+	b.WriteString("BT\n3 Tr\n")
+	for _, w := range words {
+		size := w.Top - w.Bottom
+		runes := []rune(w.Text)
+		if size <= 0 || w.Right <= w.Left {
+			continue
+		}
+		scale := 100 * (w.Right - w.Left) / (0.5 * size * float64(len(runes)))
+		fmt.Fprintf(&b, "/%s %.2f Tf %.2f Tz 1 0 0 1 %.2f %.2f Tm <", ocrFontName, size, scale, w.Left, w.Bottom)
+		for _, r := range runes {
+			if r > 0xFFFF {
+				r = 0xFFFD
+			}
+			fmt.Fprintf(&b, "%04X", r)
+		}
+		// the space keeps the words apart in the extracted text, squeezed so
+		// that its box doesn't reach into the next word
+		b.WriteString("> Tj 10 Tz <0020> Tj\n")
+	}
+	b.WriteString("ET\n")
+	return b.String()
+}
+
+func newContentStream(xt *pdfmodel.XRefTable, content string) (*types.IndirectRef, error) {
+	sd, err := xt.NewStreamDictForBuf([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return xt.IndRefForNewObject(*sd)
+}
+
+// addPageFont adds the font to the resources of a page, giving the page
+// resources of its own when it inherits them.
+func addPageFont(xt *pdfmodel.XRefTable, page types.Dict, inherited *pdfmodel.InheritedPageAttrs, font *types.IndirectRef) error {
+	res, err := xt.DereferenceDict(page["Resources"])
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		res = types.NewDict()
+		for k, v := range inherited.Resources {
+			res[k] = v
+		}
+		page["Resources"] = res
+	}
+	fonts, err := xt.DereferenceDict(res["Font"])
+	if err != nil {
+		return err
+	}
+	if fonts == nil {
+		fonts = types.NewDict()
+		res["Font"] = fonts
+	}
+	fonts[ocrFontName] = *font
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestContentTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"q 1 0 0 1 0 0 cm /Im0 Do Q", []string{"q", "1", "0", "0", "1", "0", "0", "cm", "/Im0", "Do", "Q"}},
+		{"q\r\n1.5 -2 .5 cm\tQ", []string{"q", "1.5", "-2", ".5", "cm", "Q"}},
+		{`BT (a (nested) \) string) Tj ET`, []string{"BT", "()", "Tj", "ET"}},
+		{"<48656c6c6f> Tj", []string{"<>", "Tj"}},
+		{"/P <</MCID 0>> BDC", []string{"/P", "/MCID", "0", "BDC"}},
+		{"[(a) -120 (b)] TJ", []string{"()", "-120", "()", "TJ"}},
+		{"% a comment\nq /Im0 Do % another\rQ", []string{"q", "/Im0", "Do", "Q"}},
+		{"/Im0/Im1 Do", []string{"/Im0", "/Im1", "Do"}},
+		{"BI /W 2 /H 2 ID \x00\x01Q Do EI Q", []string{"BI", "/W", "2", "/H", "2", "ID", "Q"}},
+	}
+	for _, tt := range tests {
+		if got := contentTokens([]byte(tt.in)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("contentTokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	scale := matrix{2, 0, 0, 3, 0, 0}
+	move := matrix{1, 0, 0, 1, 10, 20}
+	// scaled then moved
+	if got, want := scale.mul(move), (matrix{2, 0, 0, 3, 10, 20}); got != want {
+		t.Errorf("scale × move = %v, want %v", got, want)
+	}
+	// moved then scaled
+	if got, want := move.mul(scale), (matrix{2, 0, 0, 3, 20, 60}); got != want {
+		t.Errorf("move × scale = %v, want %v", got, want)
+	}
+	if got := identity.mul(move); got != move {
+		t.Errorf("identity × move = %v", got)
+	}
+	if x, y := move.mul(scale).apply(1, 1); x != 22 || y != 63 {
+		t.Errorf("apply(1, 1) = %v, %v, want 22, 63", x, y)
+	}
+}
+
+func TestImagePlacements(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          map[string]matrix
+	}{
+		{"none", "BT (text) Tj ET", map[string]matrix{}},
+		{"placed", "q 200 0 0 100 50 600 cm /Im0 Do Q", map[string]matrix{"Im0": {200, 0, 0, 100, 50, 600}}},
+		{
+			"nested and restored",
+			"q 2 0 0 2 10 20 cm q 100 0 0 50 0 0 cm /Im1 Do Q Q /Im2 Do",
+			map[string]matrix{"Im1": {200, 0, 0, 100, 10, 20}, "Im2": identity},
+		},
+		{
+			"rotated page",
+			"q 0 1 -1 0 612 0 cm 792 0 0 612 0 0 cm /Scan Do Q",
+			map[string]matrix{"Scan": {0, 792, -612, 0, 612, 0}},
+		},
+		{"first drawing wins", "/Im0 Do 2 0 0 2 0 0 cm /Im0 Do", map[string]matrix{"Im0": identity}},
+		{"unbalanced Q", "Q 3 0 0 3 0 0 cm /Im0 Do", map[string]matrix{"Im0": {3, 0, 0, 3, 0, 0}}},
+		{"operands of other operators", "1 0 0 RG 5 w 4 0 0 4 1 1 cm /Im0 Do", map[string]matrix{"Im0": {4, 0, 0, 4, 1, 1}}},
+		{"inline image", "q 9 0 0 9 0 0 cm BI /W 1 ID x EI Q /Im0 Do", map[string]matrix{"Im0": identity}},
+	}
+	for _, tt := range tests {
+		if got := imagePlacements([]byte(tt.content)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: imagePlacements(%q) = %v, want %v", tt.name, tt.content, got, tt.want)
+		}
+	}
+
+	// the corners of a rotated scan land on the page
+	place := imagePlacements([]byte("0 1 -1 0 612 0 cm 792 0 0 612 0 0 cm /Scan Do"))["Scan"]
+	for _, c := range []struct{ u, v, x, y float64 }{{0, 0, 612, 0}, {1, 1, 0, 792}, {1, 0, 612, 792}} {
+		x, y := place.apply(c.u, c.v)
+		if math.Abs(x-c.x) > 1e-9 || math.Abs(y-c.y) > 1e-9 {
+			t.Errorf("corner %v,%v at %v,%v, want %v,%v", c.u, c.v, x, y, c.x, c.y)
+		}
+	}
+}
+
+func TestTextLayer(t *testing.T) {
+	words := []ocrWord{
+		{Text: "Hi", Left: 10, Bottom: 20, Right: 30, Top: 30},
+		// no height, skipped
+		{Text: "flat", Left: 10, Bottom: 20, Right: 30, Top: 20},
+		{Text: "σ😀", Left: 0, Bottom: 0, Right: 5, Top: 5},
+	}
+	want := "BT\n3 Tr\n" +
+		"/LumusOCR 10.00 Tf 200.00 Tz 1 0 0 1 10.00 20.00 Tm <00480069> Tj 10 Tz <0020> Tj\n" +
+		"/LumusOCR 5.00 Tf 100.00 Tz 1 0 0 1 0.00 0.00 Tm <03C3FFFD> Tj 10 Tz <0020> Tj\n" +
+		"ET\n"
+	if got := textLayer(words); got != want {
+		t.Errorf("textLayer() =\n%s\nwant\n%s", got, want)
+	}
+}
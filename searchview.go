@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// searchItem is a result of the search view.
+type searchItem struct {
+	Result searchResult
+	Title  string
+}
+
+func (i searchItem) FilterValue() string { return i.Title }
+
+// searchDelegate shows the document and page of a result over its snippet.
+type searchDelegate struct{}
+
+func (d searchDelegate) Height() int                             { return 2 }
+func (d searchDelegate) Spacing() int                            { return 1 }
+func (d searchDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d searchDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	i, ok := listItem.(searchItem)
+	if !ok {
+		return
+	}
+	width := m.Width() - 6
+	title := runewidth.Truncate(fmt.Sprintf("%s  p. %d", i.Title, i.Result.Page), width, "…")
+	snippet := runewidth.Truncate(i.Result.Snippet, width, "…")
+	if index == m.Index() {
+		fmt.Fprint(w, selectedItemStyle.Render("→ "+title)+"\n"+itemStyle.Render(mutedStyle.Render(snippet)))
+		return
+	}
+	fmt.Fprint(w, itemStyle.Render(title)+"\n"+itemStyle.Render(mutedStyle.Render(snippet)))
+}
+
+// IndexMsg reports the end of a background update of the search index.
+type IndexMsg struct {
+	Stats indexStats
+	Err   error
+}
+
+// indexLibraryCmd brings the search index up to date with the library.
+func indexLibraryCmd() tea.Cmd {
+	return func() tea.Msg {
+		stats, err := openIndex().update(lib.docs())
+		return IndexMsg{Stats: stats, Err: err}
+	}
+}
+
+func (m model) handleIndexMsg(msg IndexMsg) (tea.Model, tea.Cmd) {
+	m.Indexing = false
+	if msg.Err != nil {
+		return m.showError("update the search index", msg.Err)
+	}
+	return m, nil
+}
+
+func newSearchInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "Search: "
+	ti.Placeholder = `word "a phrase" prefix*`
+	ti.Width = 50
+	return ti
+}
+
+func (m model) handleSearchKey() (tea.Model, tea.Cmd) {
+	if m.ReadingMode {
+		return m, nil
+	}
+	m.SearchMode = true
+	m.SearchInput.Focus()
+	if m.SearchResults.Items() == nil {
+		m.SearchResults = newSearchList(nil)
+	}
+	return m, textinput.Blink
+}
+
+func newSearchList(results []searchResult) list.Model {
+	titles := make(map[string]string)
+	for _, d := range lib.docs() {
+		titles[d.Path] = d.displayTitle()
+	}
+	items := make([]list.Item, len(results))
+	for i, r := range results {
+		title, ok := titles[r.Path]
+		if !ok {
+			title = filepath.Base(r.Path)
+		}
+		items[i] = searchItem{Result: r, Title: title}
+	}
+	l := list.New(items, searchDelegate{}, screenWidth(), listHeight-2)
+	l.SetShowTitle(false)
+	l.SetShowStatusBar(false)
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	l.Styles.PaginationStyle = paginationStyle
+	return l
+}
+
+// handleSearchViewKey types into the query, moves through the results and
+// opens the selected one. Enter searches when the query changed since the
+// last search and opens the result otherwise.
+func (m model) handleSearchViewKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.SearchMode = false
+		m.SearchInput.Blur()
+		return m, nil
+	case "up", "down", "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.SearchResults, cmd = m.SearchResults.Update(msg)
+		return m, cmd
+	case "enter":
+		if query := m.SearchInput.Value(); query != m.SearchQuery {
+			m.SearchQuery = query
+			m.SearchResults = newSearchList(openIndex().search(query, 100))
+			return m, nil
+		}
+		i, ok := m.SearchResults.SelectedItem().(searchItem)
+		if !ok {
+			return m, nil
+		}
+		cmd := m.openDocument(i.Result.Path, i.Result.Page)
+		m.Highlight = parseQuery(m.SearchQuery)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.SearchInput, cmd = m.SearchInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) searchView() string {
+	status := ""
+	switch {
+	case m.Indexing:
+		status = "updating the index…"
+	case m.SearchQuery != "" && len(m.SearchResults.Items()) == 0:
+		status = "no results"
+	case m.SearchQuery != "":
+		status = fmt.Sprintf("%d results", len(m.SearchResults.Items()))
+	}
+	help := mutedStyle.Render("    enter search/open • ↑/↓ results • esc back")
+	return fmt.Sprintf("\n%s\n  %s  %s\n\n%s\n%s", titleStyle.Render("Search"), m.SearchInput.View(), mutedStyle.Render(status), m.SearchResults.View(), help)
+}
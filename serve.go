@@ -0,0 +1,432 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// The HTTP API serves the documents of the library through the same
+// extraction as the reader. A document is known by the start of the hash
+// of its content, which survives a move. Pages carry an ETag made of the
+// key of the page cache, so a page is only extracted again when its file
+// changes.
+
+// length of the hash prefix used as the id of a document
+const docIDLength = 12
+
+// runServe serves the library over HTTP:
+// lumus serve [--addr 127.0.0.1:8080]
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: lumus serve [--addr 127.0.0.1:8080]")
+	}
+	if len(lib.roots()) == 0 {
+		return fmt.Errorf("the library is empty, add folders with: lumus library add ~/Books")
+	}
+	// bring the library and its index up to date while serving
+	go func() {
+		if _, err := lib.scan(); err != nil {
+			log.Printf("scan the library: %v", err)
+		}
+		if _, err := openIndex().update(lib.docs()); err != nil {
+			log.Printf("update the search index: %v", err)
+		}
+	}()
+	fmt.Printf("Serving %d documents on http://%s\n", len(lib.docs()), *addr)
+	return http.ListenAndServe(*addr, newServeMux())
+}
+
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/docs", serveDocs)
+	mux.HandleFunc("/docs/", servePage)
+	mux.HandleFunc("/search", serveSearch)
+	mux.HandleFunc("/read/", serveReader)
+	mux.HandleFunc("/", serveIndex)
+	return mux
+}
+
+// docJSON is a document as listed by the API.
+type docJSON struct {
+	ID     string   `json:"id"`
+	Path   string   `json:"path"`
+	Title  string   `json:"title"`
+	Author string   `json:"author,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Pages  int      `json:"pages"`
+}
+
+func newDocJSON(d libraryDoc) docJSON {
+	return docJSON{ID: docID(d), Path: d.Path, Title: d.displayTitle(), Author: d.Author, Tags: d.Tags, Pages: d.Pages}
+}
+
+func docID(d libraryDoc) string {
+	if len(d.Hash) < docIDLength {
+		return d.Hash
+	}
+	return d.Hash[:docIDLength]
+}
+
+// findDoc returns the library document of an id.
+func findDoc(id string) (libraryDoc, bool) {
+	for _, d := range lib.docs() {
+		if id != "" && docID(d) == id {
+			return d, true
+		}
+	}
+	return libraryDoc{}, false
+}
+
+// etag makes a strong validator of the parts identifying a response.
+func etag(parts ...any) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(parts...)))
+	return fmt.Sprintf(`"%x"`, sum[:8])
+}
+
+// notModified sets the ETag and answers 304 when the client has it.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(t) == tag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+func onlyGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// serveDocs lists the documents of the library: GET /docs
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	if !onlyGet(w, r) {
+		return
+	}
+	docs := lib.docs()
+	list := make([]docJSON, len(docs))
+	hashes := make([]string, len(docs))
+	for i, d := range docs {
+		list[i] = newDocJSON(d)
+		hashes[i] = d.Hash + d.Path
+	}
+	if notModified(w, r, etag(hashes)) {
+		return
+	}
+	writeJSON(w, list)
+}
+
+// wordJSON is a word of a page and its box in PDF units, from the bottom
+// left corner of the page.
+type wordJSON struct {
+	Text string  `json:"text"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	W    float64 `json:"w"`
+	H    float64 `json:"h"`
+}
+
+type pageJSON struct {
+	Doc        string     `json:"doc"`
+	Page       int        `json:"page"`
+	TotalPages int        `json:"total_pages"`
+	Text       string     `json:"text"`
+	Words      []wordJSON `json:"words"`
+}
+
+// servePage returns the text of a page, or with ?format=json or an
+// Accept of application/json its text and words:
+// GET /docs/{id}/pages/{n}
+func servePage(w http.ResponseWriter, r *http.Request) {
+	if !onlyGet(w, r) {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/docs/"), "/"), "/")
+	if len(parts) != 3 || parts[1] != "pages" {
+		http.NotFound(w, r)
+		return
+	}
+	d, ok := findDoc(parts[0])
+	if !ok {
+		http.Error(w, "no document "+parts[0], http.StatusNotFound)
+		return
+	}
+	n, err := strconv.Atoi(parts[2])
+	if err != nil || n < 1 || (d.Pages > 0 && n > d.Pages) {
+		http.Error(w, "no page "+parts[2], http.StatusNotFound)
+		return
+	}
+	asJSON := r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// the key readPDFPage caches the page under
+	key := pageKey{Path: d.Path, ModTime: info.ModTime().UnixNano(), Page: n}
+	if notModified(w, r, etag(key, conf.ExtractionOrder, asJSON)) {
+		return
+	}
+	text, total, err := readPDFPage(d.Path, n, false, 0)
+	if err != nil {
+		log.Printf("page %d of %s: %v", n, d.Path, err)
+		// the failure may pass, it must not be revalidated
+		w.Header().Del("ETag")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !asJSON {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, text)
+		return
+	}
+	words, err := pageWords(d.Path, n)
+	if err != nil {
+		log.Printf("words of page %d of %s: %v", n, d.Path, err)
+	}
+	if words == nil {
+		words = []wordJSON{}
+	}
+	writeJSON(w, pageJSON{Doc: docID(d), Page: n, TotalPages: total, Text: text, Words: words})
+}
+
+// pageWords reads the words of a page and their positions from its text
+// layer, a scanned page has none.
+func pageWords(path string, n int) (words []wordJSON, err error) {
+	// the pdf reader panics on some malformed pages
+	defer func() {
+		if recover() != nil {
+			words, err = nil, errors.New("malformed page")
+		}
+	}()
+	f, r, err := openPDF(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p := r.Page(n)
+	if p.V.IsNull() {
+		return nil, fmt.Errorf("no page %d", n)
+	}
+	// the glyphs by baseline, top of the page first
+	rows := make(map[float64][]pdf.Text)
+	for _, g := range p.Content().Text {
+		y := math.Round(g.Y)
+		rows[y] = append(rows[y], g)
+	}
+	ys := make([]float64, 0, len(rows))
+	for y := range rows {
+		ys = append(ys, y)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(ys)))
+	for _, y := range ys {
+		row := rows[y]
+		sort.SliceStable(row, func(i, j int) bool { return row[i].X < row[j].X })
+		words = append(words, rowWords(row)...)
+	}
+	return words, nil
+}
+
+// rowWords joins the glyphs of a row into words, at spaces and at gaps
+// wider than a fraction of the font size.
+func rowWords(glyphs []pdf.Text) []wordJSON {
+	var words []wordJSON
+	var cur *wordJSON
+	end := 0.0
+	for _, g := range glyphs {
+		if strings.TrimFunc(g.S, unicode.IsSpace) == "" {
+			cur = nil
+			continue
+		}
+		if cur != nil && g.X-end > g.FontSize*0.25 {
+			cur = nil
+		}
+		if cur == nil {
+			words = append(words, wordJSON{X: g.X, Y: g.Y, H: g.FontSize})
+			cur = &words[len(words)-1]
+		}
+		cur.Text += g.S
+		cur.W = g.X + g.W - cur.X
+		cur.H = math.Max(cur.H, g.FontSize)
+		end = g.X + g.W
+	}
+	return words
+}
+
+type resultJSON struct {
+	searchResult
+	Doc string `json:"doc"`
+}
+
+// serveSearch searches the library: GET /search?q=...&limit=20
+func serveSearch(w http.ResponseWriter, r *http.Request) {
+	if !onlyGet(w, r) {
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 20
+	}
+	writeJSON(w, searchResults(q, limit))
+}
+
+func searchResults(q string, limit int) []resultJSON {
+	ids := make(map[string]string)
+	for _, d := range lib.docs() {
+		ids[d.Path] = docID(d)
+	}
+	results := []resultJSON{}
+	for _, res := range openIndex().search(q, limit) {
+		results = append(results, resultJSON{searchResult: res, Doc: ids[res.Path]})
+	}
+	return results
+}
+
+// the web reader, a page per document page and a list of the documents
+var readerTemplate = template.Must(template.New("reader").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Doc}}{{.Doc.Title}} · p. {{.Page}}{{else}}Lumus{{end}}</title>
+<style>
+body { max-width: 46em; margin: 2em auto; padding: 0 1em; font: 16px/1.5 system-ui, sans-serif; color: #222; background: #fdfdfb; }
+a { color: #6a4fb3; }
+pre { white-space: pre-wrap; font: 15px/1.6 Georgia, serif; }
+nav { display: flex; gap: 1em; align-items: baseline; }
+.muted { color: #888; }
+li { margin: .3em 0; }
+</style>
+</head>
+<body>
+<nav><a href="/">Lumus</a>
+<form action="/" method="get"><input name="q" value="{{.Query}}" placeholder="Search the library"></form></nav>
+{{if .Doc}}
+<h1>{{.Doc.Title}}</h1>
+<nav>{{if gt .Page 1}}<a href="/read/{{.Doc.ID}}?page={{.Prev}}">← previous</a>{{end}}
+<span class="muted">page {{.Page}} of {{.Doc.Pages}}</span>
+{{if lt .Page .Doc.Pages}}<a href="/read/{{.Doc.ID}}?page={{.Next}}">next →</a>{{end}}</nav>
+<pre>{{.Text}}</pre>
+{{else if .Query}}
+<h1>Results</h1>
+<ul>{{range .Results}}<li><a href="/read/{{.Doc}}?page={{.Page}}">{{.Path}}</a> <span class="muted">p. {{.Page}}</span><br>{{.Snippet}}</li>{{else}}<li class="muted">No results.</li>{{end}}</ul>
+{{else}}
+<h1>Library</h1>
+<ul>{{range .Docs}}<li><a href="/read/{{.ID}}?page=1">{{.Title}}</a> <span class="muted">{{.Author}} · {{.Pages}} p.</span></li>{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+type readerPage struct {
+	Doc        *docJSON
+	Page       int
+	Prev, Next int
+	Text       string
+	Query      string
+	Results    []resultJSON
+	Docs       []docJSON
+}
+
+// serveIndex lists the library, or the results of ?q=, in HTML.
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !onlyGet(w, r) {
+		return
+	}
+	data := readerPage{Query: r.URL.Query().Get("q")}
+	if strings.TrimSpace(data.Query) != "" {
+		data.Results = searchResults(data.Query, 50)
+	} else {
+		for _, d := range lib.docs() {
+			data.Docs = append(data.Docs, newDocJSON(d))
+		}
+	}
+	renderReader(w, data)
+}
+
+// serveReader shows a page of a document: GET /read/{id}?page=n
+func serveReader(w http.ResponseWriter, r *http.Request) {
+	if !onlyGet(w, r) {
+		return
+	}
+	d, ok := findDoc(strings.Trim(strings.TrimPrefix(r.URL.Path, "/read/"), "/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || n < 1 {
+		n = 1
+	}
+	doc := newDocJSON(d)
+	if doc.Pages > 0 {
+		n = min(n, doc.Pages)
+	}
+	info, err := os.Stat(d.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	key := pageKey{Path: d.Path, ModTime: info.ModTime().UnixNano(), Page: n}
+	if notModified(w, r, etag(key, conf.ExtractionOrder, "html")) {
+		return
+	}
+	text, _, err := readPDFPage(d.Path, n, false, 0)
+	if err != nil {
+		log.Printf("page %d of %s: %v", n, d.Path, err)
+		w.Header().Del("ETag")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderReader(w, readerPage{Doc: &doc, Page: n, Prev: n - 1, Next: n + 1, Text: text})
+}
+
+func renderReader(w http.ResponseWriter, data readerPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := readerTemplate.Execute(w, data); err != nil {
+		log.Printf("render the reader: %v", err)
+	}
+}
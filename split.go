@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The split view shows a second document next to the active tab. The pane
+// with the focus is always the embedded document of the model, so that
+// the reading keys need not know about panes, and SplitDoc is the other
+// one; PaneFocus tells that the focus is on the right.
+
+// paneWidth is the width of each pane, a column is left for the separator.
+func paneWidth() int {
+	return (screenWidth() - 1) / 2
+}
+
+// textWidth is the width the pages are wrapped to.
+func (m model) textWidth() int {
+	if m.Split {
+		return paneWidth()
+	}
+	return screenWidth()
+}
+
+// swapPanes moves the focus to the other pane.
+func (m *model) swapPanes() {
+	m.document, m.SplitDoc = m.SplitDoc, m.document
+	m.PaneFocus = !m.PaneFocus
+	// the theme may have changed since the pane had the focus
+	m.Viewport.Style = bodyStyle
+}
+
+// inOtherPane runs a handler on the pane without the focus.
+func (m model) inOtherPane(handle func(model) (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	m.swapPanes()
+	next, cmd := handle(m)
+	nm, ok := next.(model)
+	if !ok {
+		return next, cmd
+	}
+	nm.swapPanes()
+	return nm, cmd
+}
+
+// handleSplitKey opens the split view on the next page of the document,
+// or closes it.
+func (m model) handleSplitKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode {
+		return m, nil
+	}
+	if m.Split {
+		return m.closeSplit()
+	}
+	m.CurrentPage = m.visiblePage()
+	page := min(m.CurrentPage+1, max(m.TotalPages, 1))
+	m.Split = true
+	m.SplitDoc = document{FileName: m.FileName, CurrentPage: page, Viewport: m.newViewport(), ShowRunningLines: m.ShowRunningLines, Continuous: m.Continuous, Highlight: m.Highlight}
+	m.layoutViewport()
+	// both panes are wrapped to their new width
+	next, cmd := m.inOtherPane(func(m model) (tea.Model, tea.Cmd) {
+		return m.handleLoadContentMsg(LoadContentMsg{FileName: m.FileName, Page: m.CurrentPage})
+	})
+	m = next.(model)
+	return m, tea.Batch(cmd, m.reloadCmd())
+}
+
+// closeSplit goes back to the active tab alone.
+func (m model) closeSplit() (tea.Model, tea.Cmd) {
+	if m.PaneFocus {
+		m.swapPanes()
+	}
+	m.Split = false
+	m.SplitDoc = document{}
+	m.layoutViewport()
+	m.CurrentPage = m.visiblePage()
+	return m, m.reloadCmd()
+}
+
+func (m model) reloadCmd() tea.Cmd {
+	fileName, page := m.FileName, m.CurrentPage
+	return func() tea.Msg {
+		return LoadContentMsg{FileName: fileName, Page: page}
+	}
+}
+
+func (m model) handlePaneKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode || !m.Split {
+		return m, nil
+	}
+	m.swapPanes()
+	return m, nil
+}
+
+func (m model) handleSyncScrollKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode || !m.Split {
+		return m, nil
+	}
+	m.SyncScroll = !m.SyncScroll
+	m.syncScroll()
+	return m, nil
+}
+
+// syncScroll scrolls the other pane to the same position, in proportion
+// to the length of its page.
+func (m *model) syncScroll() {
+	if !m.Split || !m.SyncScroll {
+		return
+	}
+	other := &m.SplitDoc.Viewport
+	maxOffset := other.TotalLineCount() - other.Height
+	if maxOffset <= 0 {
+		return
+	}
+	other.SetYOffset(int(math.Round(m.Viewport.ScrollPercent() * float64(maxOffset))))
+}
+
+// splitView shows the two panes, the focused one marked in its header.
+func (m model) splitView() string {
+	left, right := m, m
+	if m.PaneFocus {
+		left.document = m.SplitDoc
+	} else {
+		right.document = m.SplitDoc
+	}
+	leftView := left.paneView(!m.PaneFocus)
+	separator := mutedStyle.Render(strings.TrimSuffix(strings.Repeat("│\n", lipgloss.Height(leftView)), "\n"))
+	return lipgloss.JoinHorizontal(lipgloss.Top, leftView, separator, right.paneView(m.PaneFocus))
+}
+
+func (m model) paneView(focused bool) string {
+	name := filepath.Base(m.FileName)
+	if focused {
+		name = "● " + name
+	}
+	return fmt.Sprintf("%s\n%s\n%s", m.headerView(name), m.Viewport.View(), m.footerView())
+}
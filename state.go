@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// docState is where the reader stopped in a document.
+type docState struct {
+	Page       int        `json:"page"`
+	TotalPages int        `json:"total_pages"`
+	LastRead   time.Time  `json:"last_read"`
+	Bookmarks  []bookmark `json:"bookmarks,omitempty"`
+}
+
+// bookmark is a page marked in a document.
+type bookmark struct {
+	Page  int       `json:"page"`
+	Note  string    `json:"note,omitempty"`
+	Added time.Time `json:"added"`
+}
+
+// readingHistory remembers the last page read of every document, by
+// absolute path. It is saved after every change.
+type readingHistory struct {
+	mu   sync.Mutex
+	path string
+	Docs map[string]docState `json:"docs"`
+}
+
+var history = loadHistory(statePath())
+
+// stateDir returns $XDG_STATE_HOME/lumus, falling back to ~/.local/state
+// when XDG_STATE_HOME is not set.
+func stateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "lumus")
+}
+
+// statePath returns the path of the reading history.
+func statePath() string {
+	dir := stateDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "history.json")
+}
+
+// loadHistory reads the history file. A missing or unreadable file gives
+// an empty history, reading progress is not worth failing over.
+func loadHistory(path string) *readingHistory {
+	h := &readingHistory{path: path, Docs: make(map[string]docState)}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+	if err := json.Unmarshal(data, h); err != nil || h.Docs == nil {
+		h.Docs = make(map[string]docState)
+	}
+	return h
+}
+
+func (h *readingHistory) get(path string) (docState, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.Docs[path]
+	return s, ok
+}
+
+// record saves the page being read.
+func (h *readingHistory) record(path string, page, totalPages int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.Docs[path]
+	s.Page, s.TotalPages, s.LastRead = page, totalPages, time.Now()
+	h.Docs[path] = s
+	return h.save()
+}
+
+// addBookmark marks a page of a document.
+func (h *readingHistory) addBookmark(path string, b bookmark) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.Docs[path]
+	s.Bookmarks = append(s.Bookmarks, b)
+	h.Docs[path] = s
+	return h.save()
+}
+
+// recentDoc is a document of the history.
+type recentDoc struct {
+	Path string
+	docState
+}
+
+// recent returns the documents that still exist, last read first.
+func (h *readingHistory) recent(n int) []recentDoc {
+	h.mu.Lock()
+	docs := make([]recentDoc, 0, len(h.Docs))
+	for path, s := range h.Docs {
+		docs = append(docs, recentDoc{Path: path, docState: s})
+	}
+	h.mu.Unlock()
+	sort.Slice(docs, func(i, j int) bool { return docs[i].LastRead.After(docs[j].LastRead) })
+
+	var recent []recentDoc
+	for _, d := range docs {
+		if len(recent) == n {
+			break
+		}
+		// bookmarked but never read
+		if d.LastRead.IsZero() {
+			continue
+		}
+		if _, err := os.Stat(d.Path); err == nil {
+			recent = append(recent, d)
+		}
+	}
+	return recent
+}
+
+func (h *readingHistory) save() error {
+	if h.path == "" {
+		return errors.New("no state directory")
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return writeFileAtomic(h.path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomic writes a file next to path and renames it over path
+// once complete, so that a failed write leaves the old file alone. The
+// file keeps the mode of the one it replaces, a new one is 0644.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lumus-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// progress returns how far the document was read, as "37%", or "" when it
+// was never opened.
+func (s docState) progress() string {
+	if s.TotalPages <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%%", s.Page*100/s.TotalPages)
+}
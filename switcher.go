@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// number of recent documents offered by the quick switcher
+const recentLimit = 20
+
+// switchItem is a document the quick switcher can open: a recent one or
+// one of the library.
+type switchItem struct {
+	Path  string
+	Title string
+	// zero for library documents never opened
+	State docState
+}
+
+func (i switchItem) filterValue() string {
+	return i.Title + " " + filepath.Base(i.Path)
+}
+
+// switchItems lists the recent documents, last read first, then the
+// library documents that were never read.
+func switchItems() []switchItem {
+	titles := make(map[string]string)
+	docs := lib.docs()
+	for _, d := range docs {
+		titles[d.Path] = d.displayTitle()
+	}
+	title := func(path string) string {
+		if t, ok := titles[path]; ok {
+			return t
+		}
+		return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	var items []switchItem
+	seen := make(map[string]bool)
+	for _, r := range history.recent(recentLimit) {
+		items = append(items, switchItem{Path: r.Path, Title: title(r.Path), State: r.docState})
+		seen[r.Path] = true
+	}
+	for _, d := range docs {
+		if !seen[d.Path] {
+			s, _ := history.get(d.Path)
+			items = append(items, switchItem{Path: d.Path, Title: d.displayTitle(), State: s})
+		}
+	}
+	return items
+}
+
+func newSwitcherInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "Open: "
+	ti.Placeholder = "title or file name"
+	ti.Width = 40
+	return ti
+}
+
+// openSwitcher shows the quick switcher with every candidate.
+func (m model) openSwitcher() (model, tea.Cmd) {
+	m.ShowSwitcher = true
+	m.SwitcherItems = switchItems()
+	m.SwitcherInput.Reset()
+	m.SwitcherInput.Focus()
+	m.filterSwitcher()
+	return m, textinput.Blink
+}
+
+// filterSwitcher fuzzy matches the query against the candidates, in their
+// order when the query is empty.
+func (m *model) filterSwitcher() {
+	m.SwitcherIdx = 0
+	query := m.SwitcherInput.Value()
+	if query == "" {
+		m.SwitcherMatches = m.SwitcherItems
+		return
+	}
+	targets := make([]string, len(m.SwitcherItems))
+	for i, item := range m.SwitcherItems {
+		targets[i] = item.filterValue()
+	}
+	m.SwitcherMatches = nil
+	for _, rank := range list.DefaultFilter(query, targets) {
+		m.SwitcherMatches = append(m.SwitcherMatches, m.SwitcherItems[rank.Index])
+	}
+}
+
+func (m model) handleSwitcherKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if keyMatches(msg.String(), m.Keys.Switcher) {
+		m.ShowSwitcher = false
+		m.SwitcherInput.Blur()
+		return m, nil
+	}
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.ShowSwitcher = false
+		m.SwitcherInput.Blur()
+		return m, nil
+	case "up", "ctrl+p":
+		if m.SwitcherIdx > 0 {
+			m.SwitcherIdx--
+		}
+		return m, nil
+	case "down", "ctrl+n":
+		if m.SwitcherIdx < len(m.SwitcherMatches)-1 {
+			m.SwitcherIdx++
+		}
+		return m, nil
+	case "enter":
+		if m.SwitcherIdx >= len(m.SwitcherMatches) {
+			return m, nil
+		}
+		item := m.SwitcherMatches[m.SwitcherIdx]
+		m.ShowSwitcher = false
+		m.SwitcherInput.Blur()
+		page := 1
+		if item.State.Page > 0 {
+			page = item.State.Page
+		}
+		cmd := m.openDocument(item.Path, page)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.SwitcherInput, cmd = m.SwitcherInput.Update(msg)
+	m.filterSwitcher()
+	return m, cmd
+}
+
+// ago formats how long ago t was, roughly.
+func ago(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d h ago", int(d.Hours()))
+	case d < 7*24*time.Hour:
+		return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+	}
+	return t.Format("2006-01-02")
+}
+
+func (m model) switcherView() string {
+	width := min(screenWidth()-8, 90)
+	height := max(screenHeight()-10, 3)
+
+	var b strings.Builder
+	b.WriteString(m.SwitcherInput.View() + "\n\n")
+	if len(m.SwitcherMatches) == 0 {
+		if len(m.SwitcherItems) == 0 {
+			b.WriteString(mutedStyle.Render("No recent documents yet.") + "\n")
+		} else {
+			b.WriteString(mutedStyle.Render("No match.") + "\n")
+		}
+	}
+	// keep the selection in sight
+	first := 0
+	if m.SwitcherIdx >= height {
+		first = m.SwitcherIdx - height + 1
+	}
+	for i := first; i < len(m.SwitcherMatches) && i < first+height; i++ {
+		item := m.SwitcherMatches[i]
+		details := ""
+		if item.State.TotalPages > 0 {
+			details = fmt.Sprintf("p. %d/%d · %s", item.State.Page, item.State.TotalPages, ago(item.State.LastRead))
+		}
+		// the padding of the box, the arrow and the gap before the details
+		nameWidth := width - 8 - runewidth.StringWidth(details)
+		line := runewidth.FillRight(runewidth.Truncate(item.Title, nameWidth, "…"), nameWidth) + "  " + mutedStyle.Render(details)
+		if i == m.SwitcherIdx {
+			line = selectedItemStyle.Copy().PaddingLeft(0).Render("→ " + line)
+		} else {
+			line = "  " + line
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n" + mutedStyle.Render("enter open • ↑/↓ select • esc close"))
+	box := helpBoxStyle.Copy().Width(width).Render(b.String())
+	return lipgloss.Place(screenWidth(), screenHeight(), lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SyncTeX links the lines of the LaTeX sources to the places of the PDF
+// they were typeset to. pdflatex -synctex=1 writes it next to the PDF, as
+// name.synctex.gz.
+
+// synctexRecord is a box or a point of a page and the source line it
+// comes from. The coordinates grow to the right and down.
+type synctexRecord struct {
+	Input int
+	Line  int
+	Page  int
+	X, Y  int
+}
+
+// synctex holds the records of a document, Inputs maps the tags of the
+// records to the absolute paths of the source files.
+type synctex struct {
+	Inputs  map[int]string
+	Records []synctexRecord
+}
+
+var errNoSynctex = errors.New("no .synctex.gz next to the document, compile it with -synctex=1")
+
+// synctexPath returns the SyncTeX file of a PDF, compressed or not.
+func synctexPath(pdfPath string) (string, error) {
+	base := strings.TrimSuffix(pdfPath, filepath.Ext(pdfPath))
+	for _, ext := range []string{".synctex.gz", ".synctex"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext, nil
+		}
+	}
+	return "", errNoSynctex
+}
+
+// loadSynctex reads the SyncTeX file of a PDF.
+func loadSynctex(pdfPath string) (*synctex, error) {
+	path, err := synctexPath(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	st, err := parseSynctex(r, filepath.Dir(pdfPath))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return st, nil
+}
+
+// parseSynctex reads the preamble inputs and the records of the content,
+// the paths of the inputs being relative to dir.
+func parseSynctex(r io.Reader, dir string) (*synctex, error) {
+	st := &synctex{Inputs: map[int]string{}}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	page := 0
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "Input:") {
+			tag, path, ok := strings.Cut(strings.TrimPrefix(line, "Input:"), ":")
+			n, err := strconv.Atoi(tag)
+			if !ok || err != nil {
+				continue
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			st.Inputs[n] = filepath.Clean(path)
+			continue
+		}
+		switch line[0] {
+		case '{':
+			page, _ = strconv.Atoi(line[1:])
+		case '}':
+			page = 0
+		case '[', '(', 'v', 'h', 'x', 'k', 'g', '$':
+			if page == 0 {
+				continue
+			}
+			if rec, ok := parseSynctexRecord(line[1:]); ok {
+				rec.Page = page
+				st.Records = append(st.Records, rec)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(st.Records) == 0 {
+		return nil, errors.New("no records")
+	}
+	return st, nil
+}
+
+// parseSynctexRecord reads "tag,line[,column]:x,y[:...]".
+func parseSynctexRecord(s string) (synctexRecord, bool) {
+	fields := strings.SplitN(s, ":", 3)
+	if len(fields) < 2 {
+		return synctexRecord{}, false
+	}
+	src := strings.Split(fields[0], ",")
+	pos := strings.Split(fields[1], ",")
+	if len(src) < 2 || len(pos) < 2 {
+		return synctexRecord{}, false
+	}
+	var rec synctexRecord
+	var errs [4]error
+	rec.Input, errs[0] = strconv.Atoi(src[0])
+	rec.Line, errs[1] = strconv.Atoi(src[1])
+	rec.X, errs[2] = strconv.Atoi(pos[0])
+	rec.Y, errs[3] = strconv.Atoi(pos[1])
+	for _, err := range errs {
+		if err != nil {
+			return synctexRecord{}, false
+		}
+	}
+	return rec, true
+}
+
+// input returns the tag of a source file, matched by path or else by
+// name.
+func (st *synctex) input(file string) (int, bool) {
+	abs, err := filepath.Abs(file)
+	if err == nil {
+		for tag, path := range st.Inputs {
+			if path == abs {
+				return tag, true
+			}
+		}
+	}
+	for tag, path := range st.Inputs {
+		if filepath.Base(path) == filepath.Base(file) {
+			return tag, true
+		}
+	}
+	return 0, false
+}
+
+// forward returns the page a line of a source file was typeset on. A
+// line without a record of its own, such as a blank one, goes to the
+// closest line above it that has one.
+func (st *synctex) forward(file string, line int) (int, error) {
+	tag, ok := st.input(file)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a source of the document", file)
+	}
+	page, best := 0, -1
+	for _, rec := range st.Records {
+		// line 0 is no line at all
+		if rec.Input != tag || rec.Line < 1 || rec.Line > line || rec.Line <= best {
+			continue
+		}
+		page, best = rec.Page, rec.Line
+		if best == line {
+			break
+		}
+	}
+	if page == 0 {
+		return 0, fmt.Errorf("no page for %s:%d", file, line)
+	}
+	return page, nil
+}
+
+// inverse returns the source line typeset closest to a height of a page,
+// given as a fraction of the text from its top.
+func (st *synctex) inverse(page int, fraction float64) (string, int, error) {
+	top, bottom := math.MaxInt, math.MinInt
+	for _, rec := range st.Records {
+		if rec.Page == page && rec.Line > 0 {
+			top, bottom = min(top, rec.Y), max(bottom, rec.Y)
+		}
+	}
+	if top > bottom {
+		return "", 0, fmt.Errorf("no source for page %d", page)
+	}
+	y := float64(top) + fraction*float64(bottom-top)
+	var found synctexRecord
+	dist := math.Inf(1)
+	for _, rec := range st.Records {
+		if rec.Page != page || rec.Line == 0 {
+			continue
+		}
+		if d := math.Abs(float64(rec.Y) - y); d < dist {
+			found, dist = rec, d
+		}
+	}
+	path, ok := st.Inputs[found.Input]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown input %d", found.Input)
+	}
+	return path, found.Line, nil
+}
+
+// parseSourceLine splits "file.tex:line".
+func parseSourceLine(s string) (string, int, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("%q is not file.tex:line", s)
+	}
+	line, err := strconv.Atoi(s[i+1:])
+	if err != nil || line < 1 {
+		return "", 0, fmt.Errorf("%q is not file.tex:line", s)
+	}
+	return s[:i], line, nil
+}
+
+// forwardSearch opens the page of the PDF that a source line is on. The
+// PDF defaults to the one named after the source file.
+func forwardSearch(keys keyMap, target string, args []string) (model, error) {
+	file, line, err := parseSourceLine(target)
+	if err != nil {
+		return model{}, err
+	}
+	pdfPath := strings.TrimSuffix(file, filepath.Ext(file)) + ".pdf"
+	switch len(args) {
+	case 0:
+	case 1:
+		pdfPath = args[0]
+	default:
+		return model{}, errors.New("usage: lumus --synctex-forward file.tex:line [file.pdf]")
+	}
+	if pdfPath, err = filepath.Abs(pdfPath); err != nil {
+		return model{}, err
+	}
+	st, err := loadSynctex(pdfPath)
+	if err != nil {
+		return model{}, err
+	}
+	page, err := st.forward(file, line)
+	if err != nil {
+		return model{}, err
+	}
+	m := initialModel(keys, filepath.Dir(pdfPath))
+	m.ShowSwitcher = false
+	m.openDocument(pdfPath, page)
+	return m, nil
+}
+
+// editorCommand fills the editor command of the config with a source
+// line: %f is the file, %l the line. Without one $VISUAL or $EDITOR is
+// started on the line.
+func editorCommand(file string, line int) (*exec.Cmd, error) {
+	template := conf.SynctexEditor
+	if template == "" {
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			return nil, errors.New("no editor, set synctex_editor in the config file or $EDITOR")
+		}
+		template = editor + " +%l %f"
+	}
+	// split before filling in, the file name may have spaces
+	args := strings.Fields(template)
+	for i, arg := range args {
+		args[i] = strings.NewReplacer("%f", file, "%l", strconv.Itoa(line), "%%", "%").Replace(arg)
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// handleInverseSearchKey opens the editor on the source of the line at
+// the top of the view.
+func (m model) handleInverseSearchKey() (tea.Model, tea.Cmd) {
+	if !m.ReadingMode || m.FileName == "" {
+		return m, nil
+	}
+	st, err := loadSynctex(m.FileName)
+	if err != nil {
+		return m.showError("inverse search", err)
+	}
+	page := m.visiblePage()
+	fraction := 0.0
+	if lines := m.pageLines(); lines > 1 {
+		fraction = float64(m.pageOffset()) / float64(lines-1)
+	}
+	file, line, err := st.inverse(page, min(fraction, 1))
+	if err != nil {
+		return m.showError("inverse search", err)
+	}
+	cmd, err := editorCommand(file, line)
+	if err != nil {
+		return m.showError("inverse search", err)
+	}
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		if err != nil {
+			return ErrorMsg{Op: "run editor", Err: err}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSynctex = `SyncTeX Version:1
+Input:1:./main.tex
+Input:2:/abs/chapters/intro.tex
+Output:pdf
+Magnification:1000
+Unit:1
+X Offset:0
+Y Offset:0
+Content:
+!100
+{1
+[1,10:4736286,5000000:30000000,40000000,0
+(1,10:4736286,6000000:100,200,0
+h1,11:4736286,7000000:100,200,0
+(2,3:4736286,9000000:100,200,0
+]
+}1
+{2
+[1,20:4736286,4000000:30000000,40000000,0
+(1,20:4736286,4000000:100,200,0
+x1,25:4736286,8000000
+g1,30:4736286,12000000
+$1,0:4736286,13000000
+}2
+garbage line
+Postamble:
+Count:10
+`
+
+func TestParseSynctex(t *testing.T) {
+	st, err := parseSynctex(strings.NewReader(testSynctex), "/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInputs := map[int]string{1: "/doc/main.tex", 2: "/abs/chapters/intro.tex"}
+	if !reflect.DeepEqual(st.Inputs, wantInputs) {
+		t.Errorf("inputs = %v, want %v", st.Inputs, wantInputs)
+	}
+	if len(st.Records) != 9 {
+		t.Fatalf("%d records, want 9", len(st.Records))
+	}
+	if want := (synctexRecord{Input: 2, Line: 3, Page: 1, X: 4736286, Y: 9000000}); st.Records[3] != want {
+		t.Errorf("record 3 = %+v, want %+v", st.Records[3], want)
+	}
+
+	if _, err := parseSynctex(strings.NewReader("SyncTeX Version:1\nInput:1:a.tex\n"), "/doc"); err == nil {
+		t.Error("a file without records parsed")
+	}
+}
+
+func TestSynctexForwardInverse(t *testing.T) {
+	st, err := parseSynctex(strings.NewReader(testSynctex), "/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forward := []struct {
+		file string
+		line int
+		page int
+	}{
+		{"/doc/main.tex", 10, 1},
+		{"main.tex", 11, 1},
+		// no record of its own, the closest line above
+		{"main.tex", 15, 1},
+		{"main.tex", 22, 2},
+		{"/elsewhere/intro.tex", 3, 1},
+	}
+	for _, tt := range forward {
+		if page, err := st.forward(tt.file, tt.line); err != nil || page != tt.page {
+			t.Errorf("forward(%s, %d) = %d, %v, want %d", tt.file, tt.line, page, err, tt.page)
+		}
+	}
+	if _, err := st.forward("main.tex", 5); err == nil {
+		t.Error("forward to a line before the first record succeeded")
+	}
+	if _, err := st.forward("other.tex", 1); err == nil {
+		t.Error("forward from a file that is not a source succeeded")
+	}
+
+	inverse := []struct {
+		page     int
+		fraction float64
+		file     string
+		line     int
+	}{
+		{1, 0, "/doc/main.tex", 10},
+		{1, 1, "/abs/chapters/intro.tex", 3},
+		{2, 0, "/doc/main.tex", 20},
+		{2, 0.5, "/doc/main.tex", 25},
+		{2, 1, "/doc/main.tex", 30},
+	}
+	for _, tt := range inverse {
+		file, line, err := st.inverse(tt.page, tt.fraction)
+		if err != nil || file != tt.file || line != tt.line {
+			t.Errorf("inverse(%d, %v) = %s:%d, %v, want %s:%d", tt.page, tt.fraction, file, line, err, tt.file, tt.line)
+		}
+	}
+	if _, _, err := st.inverse(3, 0); err == nil {
+		t.Error("inverse on a page without records succeeded")
+	}
+}
+
+func TestLoadSynctexGzip(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "main.synctex.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(testSynctex))
+	gz.Close()
+	f.Close()
+	st, err := loadSynctex(filepath.Join(dir, "main.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Inputs[1] != filepath.Join(dir, "main.tex") {
+		t.Errorf("input 1 = %s", st.Inputs[1])
+	}
+	if _, err := loadSynctex(filepath.Join(dir, "other.pdf")); err != errNoSynctex {
+		t.Errorf("loadSynctex without a file: %v", err)
+	}
+}
+
+func TestParseSourceLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		file string
+		line int
+		ok   bool
+	}{
+		{"main.tex:12", "main.tex", 12, true},
+		{"C:/tex/main.tex:3", "C:/tex/main.tex", 3, true},
+		{"main.tex", "", 0, false},
+		{"main.tex:0", "", 0, false},
+		{"main.tex:x", "", 0, false},
+		{":4", "", 0, false},
+	}
+	for _, tt := range tests {
+		file, line, err := parseSourceLine(tt.in)
+		if (err == nil) != tt.ok || file != tt.file || line != tt.line {
+			t.Errorf("parseSourceLine(%q) = %q, %d, %v", tt.in, file, line, err)
+		}
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	saved := conf.SynctexEditor
+	defer func() { conf.SynctexEditor = saved }()
+	tests := []struct {
+		template, visual, editor string
+		want                     []string
+	}{
+		{"code --goto %f:%l", "", "", []string{"code", "--goto", "/my docs/a.tex:42"}},
+		{"nvim --server /tmp/nvim --remote-send :%l<CR> %f", "", "", []string{"nvim", "--server", "/tmp/nvim", "--remote-send", ":42<CR>", "/my docs/a.tex"}},
+		{"ed 100%% %f", "", "", []string{"ed", "100%", "/my docs/a.tex"}},
+		{"", "vim", "nano", []string{"vim", "+42", "/my docs/a.tex"}},
+		{"", "", "nano", []string{"nano", "+42", "/my docs/a.tex"}},
+	}
+	for _, tt := range tests {
+		conf.SynctexEditor = tt.template
+		t.Setenv("VISUAL", tt.visual)
+		t.Setenv("EDITOR", tt.editor)
+		cmd, err := editorCommand("/my docs/a.tex", 42)
+		if err != nil {
+			t.Errorf("editorCommand with %q: %v", tt.template, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Args, tt.want) {
+			t.Errorf("editorCommand with %q = %q, want %q", tt.template, cmd.Args, tt.want)
+		}
+	}
+	conf.SynctexEditor = ""
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if _, err := editorCommand("a.tex", 1); err == nil {
+		t.Error("editorCommand without an editor succeeded")
+	}
+}
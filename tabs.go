@@ -0,0 +1,195 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// document is the reading state of an open document, one per tab.
+type document struct {
+	// absolute path of the open document
+	FileName    string
+	Content     string
+	CurrentPage int
+	TotalPages  int
+	Viewport    viewport.Model
+	// show running headers, footers and page numbers
+	ShowRunningLines bool
+	// continuous scroll across page boundaries
+	Continuous    bool
+	Window        []windowPage
+	WindowLoading bool
+	// query of the search result being read, its matches are highlighted
+	Highlight []queryClause
+	// size and time of the file when its page was read, and of a new
+	// version waiting to be complete
+	Stamp   fileStamp
+	pending fileStamp
+	// short message in the footer, such as "reloaded"
+	Notice string
+	// when the tab was last shown, closing a tab goes back to the most
+	// recent of the others
+	shown int
+}
+
+// widest tab title in the tab bar
+const tabWidth = 24
+
+// openDocument loads a page of path in its own tab: the tab of the
+// document when it is already open, a new one otherwise. The new tab
+// keeps the reading settings of the current one.
+func (m *model) openDocument(path string, page int) tea.Cmd {
+	open := -1
+	for i, t := range m.Tabs {
+		if t.FileName == path {
+			open = i
+		}
+	}
+	switch {
+	case m.Split && m.PaneFocus:
+		// the right pane shows a document of its own, outside the tabs
+		m.document = document{FileName: path, Viewport: m.Viewport, ShowRunningLines: m.ShowRunningLines, Continuous: m.Continuous}
+	case open >= 0:
+		m.showTab(open)
+	case len(m.Tabs) == 0:
+		m.document = document{FileName: path, Viewport: m.Viewport, ShowRunningLines: m.ShowRunningLines, Continuous: m.Continuous}
+		m.Tabs = []document{m.document}
+		m.ActiveTab = 0
+	default:
+		m.Tabs = append(m.Tabs, document{FileName: path, Viewport: m.newViewport(), ShowRunningLines: m.ShowRunningLines, Continuous: m.Continuous})
+		m.showTab(len(m.Tabs) - 1)
+	}
+	m.layoutViewport()
+	m.DiffMode = false
+	m.CurrentPage = page
+	m.Window = nil
+	m.Loading = true
+	return func() tea.Msg {
+		return LoadContentMsg{FileName: path, Page: page}
+	}
+}
+
+// showTab saves the active document and makes tab i the active one.
+func (m *model) showTab(i int) {
+	// the tab goes to the left pane of the split view
+	if m.PaneFocus {
+		m.swapPanes()
+	}
+	// a page still loading for the tab left behind is dropped
+	m.WindowLoading = false
+	if m.ActiveTab < len(m.Tabs) {
+		m.Tabs[m.ActiveTab] = m.document
+	}
+	m.ActiveTab = i
+	m.document = m.Tabs[i]
+	m.tabSeq++
+	m.shown = m.tabSeq
+	// the theme may have changed since the tab was last shown
+	m.Viewport.Style = bodyStyle
+	m.layoutViewport()
+}
+
+// closeTab closes the active tab and goes back to the one shown before it.
+func (m *model) closeTab() {
+	m.Tabs = append(m.Tabs[:m.ActiveTab], m.Tabs[m.ActiveTab+1:]...)
+	prev := 0
+	for i, t := range m.Tabs {
+		if t.shown > m.Tabs[prev].shown {
+			prev = i
+		}
+	}
+	// the closed document is not saved back
+	m.ActiveTab = len(m.Tabs)
+	m.showTab(prev)
+}
+
+// dropUnopenedTab closes the active tab when its document could not be
+// opened at all.
+func (m *model) dropUnopenedTab() {
+	if m.Content != "" || m.PaneFocus {
+		return
+	}
+	if len(m.Tabs) > 1 {
+		m.closeTab()
+		return
+	}
+	m.Tabs = nil
+}
+
+// handleTabKey shows the next tab, or the previous one for a negative
+// step. From the browser it goes back to the active tab.
+func (m model) handleTabKey(step int) (tea.Model, tea.Cmd) {
+	if len(m.Tabs) == 0 {
+		return m, nil
+	}
+	if !m.ReadingMode {
+		m.ReadingMode = true
+		m.layoutViewport()
+		return m, nil
+	}
+	m.showTab((m.ActiveTab + step + len(m.Tabs)) % len(m.Tabs))
+	return m, nil
+}
+
+func (m model) showTabBar() bool {
+	return len(m.Tabs) > 1
+}
+
+func (m model) newViewport() viewport.Model {
+	v := viewport.New(screenWidth(), m.viewportHeight())
+	v.HighPerformanceRendering = conf.HighPerformanceRenderer
+	v.Style = bodyStyle
+	// Render the viewport one line below the header.
+	v.YPosition = m.viewportTop()
+	return v
+}
+
+// layoutViewport fits the viewport between the header, and the tab bar
+// when shown, and the footer. In the split view both panes are laid out.
+func (m *model) layoutViewport() {
+	m.Viewport.Width = screenWidth()
+	m.Viewport.Height = m.viewportHeight()
+	m.Viewport.YPosition = m.viewportTop()
+	if m.Split {
+		m.Viewport.Width = paneWidth()
+		m.SplitDoc.Viewport.Width = paneWidth()
+		m.SplitDoc.Viewport.Height = m.Viewport.Height
+		m.SplitDoc.Viewport.YPosition = m.Viewport.YPosition
+	}
+}
+
+func (m model) viewportTop() int {
+	top := lipgloss.Height(m.headerView(m.FileName)) + 1
+	if m.showTabBar() {
+		top += lipgloss.Height(m.tabBarView())
+	}
+	return top
+}
+
+func (m model) viewportHeight() int {
+	height := screenHeight() - lipgloss.Height(m.headerView(m.FileName)) - lipgloss.Height(m.footerView())
+	if m.showTabBar() {
+		height -= lipgloss.Height(m.tabBarView())
+	}
+	return max(height, 1)
+}
+
+// tabBarView lists the open documents by file name, the active one
+// highlighted.
+func (m model) tabBarView() string {
+	tabs := make([]string, len(m.Tabs))
+	for i, t := range m.Tabs {
+		name := runewidth.Truncate(strings.TrimSuffix(filepath.Base(t.FileName), filepath.Ext(t.FileName)), tabWidth, "…")
+		if i == m.ActiveTab {
+			tabs[i] = activeTabStyle.Render(name)
+		} else {
+			tabs[i] = tabStyle.Render(name)
+		}
+	}
+	return lipgloss.NewStyle().MaxWidth(screenWidth()).Render(strings.Join(tabs, " "))
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// themeColor is a color for light and dark terminal backgrounds. In a theme
+// file it is either a single color, "252" or "#FFFAE0", or a table with
+// both variants: { light = "235", dark = "252" }.
+type themeColor struct {
+	Light string `toml:"light"`
+	Dark  string `toml:"dark"`
+}
+
+func (c *themeColor) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		c.Light, c.Dark = v, v
+	case map[string]interface{}:
+		light, _ := v["light"].(string)
+		dark, _ := v["dark"].(string)
+		if light == "" || dark == "" {
+			return errors.New("a color table needs both light and dark")
+		}
+		c.Light, c.Dark = light, dark
+	default:
+		return fmt.Errorf("a color must be a string or a table, got %T", v)
+	}
+	return nil
+}
+
+func (c themeColor) color() lipgloss.TerminalColor {
+	if c.Light == "" && c.Dark == "" {
+		return lipgloss.NoColor{}
+	}
+	return lipgloss.AdaptiveColor{Light: c.Light, Dark: c.Dark}
+}
+
+func sameColor(c string) themeColor {
+	return themeColor{Light: c, Dark: c}
+}
+
+type theme struct {
+	// list title, header and footer borders, spinner
+	Accent themeColor `toml:"accent"`
+	// file names in the browser
+	Item               themeColor `toml:"item"`
+	Selected           themeColor `toml:"selected"`
+	SelectedBackground themeColor `toml:"selected_background"`
+	// page text
+	Text           themeColor `toml:"text"`
+	TextBackground themeColor `toml:"text_background"`
+	// help, page separators and other secondary text
+	Muted themeColor `toml:"muted"`
+	// highlighted text, e.g. the text under the cursor
+	Highlight           themeColor `toml:"highlight"`
+	HighlightBackground themeColor `toml:"highlight_background"`
+	// search matches
+	Match           themeColor `toml:"match"`
+	MatchBackground themeColor `toml:"match_background"`
+	// status bar of errors
+	Error           themeColor `toml:"error"`
+	ErrorBackground themeColor `toml:"error_background"`
+	// words added and removed in a diff
+	Inserted themeColor `toml:"inserted"`
+	Deleted  themeColor `toml:"deleted"`
+}
+
+var builtinThemes = map[string]theme{
+	// adapts to the terminal background
+	"auto": {
+		Accent:              themeColor{Light: "27", Dark: "69"},
+		Item:                themeColor{Light: "235", Dark: "252"},
+		Selected:            themeColor{Light: "#002236", Dark: "#FFFAE0"},
+		SelectedBackground:  themeColor{Light: "#D6E9F5", Dark: "#002236"},
+		Text:                themeColor{Light: "235", Dark: "252"},
+		Muted:               themeColor{Light: "245", Dark: "241"},
+		Highlight:           themeColor{Light: "#000000", Dark: "#FFFFFF"},
+		HighlightBackground: themeColor{Light: "#C6DBF0", Dark: "#3A3F5A"},
+		Match:               themeColor{Light: "#000000", Dark: "#000000"},
+		MatchBackground:     themeColor{Light: "#FFD75F", Dark: "#FFAF00"},
+		Error:               themeColor{Light: "#FFFFFF", Dark: "#FFFFFF"},
+		ErrorBackground:     themeColor{Light: "#C0392B", Dark: "#A93226"},
+		Inserted:            themeColor{Light: "#1E7B34", Dark: "#5FD75F"},
+		Deleted:             themeColor{Light: "#C0392B", Dark: "#FF5F5F"},
+	},
+	"dark": {
+		Accent:              sameColor("69"),
+		Item:                sameColor("252"),
+		Selected:            sameColor("#FFFAE0"),
+		SelectedBackground:  sameColor("#002236"),
+		Text:                sameColor("252"),
+		Muted:               sameColor("241"),
+		Highlight:           sameColor("#FFFFFF"),
+		HighlightBackground: sameColor("#3A3F5A"),
+		Match:               sameColor("#000000"),
+		MatchBackground:     sameColor("#FFAF00"),
+		Error:               sameColor("#FFFFFF"),
+		ErrorBackground:     sameColor("#A93226"),
+		Inserted:            sameColor("#5FD75F"),
+		Deleted:             sameColor("#FF5F5F"),
+	},
+	"light": {
+		Accent:              sameColor("27"),
+		Item:                sameColor("235"),
+		Selected:            sameColor("#002236"),
+		SelectedBackground:  sameColor("#D6E9F5"),
+		Text:                sameColor("235"),
+		TextBackground:      sameColor("#FAFAFA"),
+		Muted:               sameColor("245"),
+		Highlight:           sameColor("#000000"),
+		HighlightBackground: sameColor("#C6DBF0"),
+		Match:               sameColor("#000000"),
+		MatchBackground:     sameColor("#FFD75F"),
+		Error:               sameColor("#FFFFFF"),
+		ErrorBackground:     sameColor("#C0392B"),
+		Inserted:            sameColor("#1E7B34"),
+		Deleted:             sameColor("#C0392B"),
+	},
+	"sepia": {
+		Accent:              sameColor("#8B5A2B"),
+		Item:                sameColor("#5B4636"),
+		Selected:            sameColor("#F4ECD8"),
+		SelectedBackground:  sameColor("#8B5A2B"),
+		Text:                sameColor("#5B4636"),
+		TextBackground:      sameColor("#F4ECD8"),
+		Muted:               sameColor("#A08C72"),
+		Highlight:           sameColor("#3B2A1E"),
+		HighlightBackground: sameColor("#E3D3B0"),
+		Match:               sameColor("#3B2A1E"),
+		MatchBackground:     sameColor("#E8B96A"),
+		Error:               sameColor("#F4ECD8"),
+		ErrorBackground:     sameColor("#9E3B26"),
+		Inserted:            sameColor("#4E7A27"),
+		Deleted:             sameColor("#9E3B26"),
+	},
+	"high-contrast": {
+		Accent:              sameColor("#FFFF00"),
+		Item:                sameColor("#FFFFFF"),
+		Selected:            sameColor("#000000"),
+		SelectedBackground:  sameColor("#FFFF00"),
+		Text:                sameColor("#FFFFFF"),
+		TextBackground:      sameColor("#000000"),
+		Muted:               sameColor("#00FFFF"),
+		Highlight:           sameColor("#000000"),
+		HighlightBackground: sameColor("#00FFFF"),
+		Match:               sameColor("#000000"),
+		MatchBackground:     sameColor("#FF00FF"),
+		Error:               sameColor("#FFFFFF"),
+		ErrorBackground:     sameColor("#FF0000"),
+		Inserted:            sameColor("#00FF00"),
+		Deleted:             sameColor("#FF0000"),
+	},
+}
+
+var builtinThemeOrder = []string{"auto", "dark", "light", "sepia", "high-contrast"}
+
+// themes holds the built-in themes and the ones found in the themes
+// directory.
+var themes = builtinThemes
+
+// themesDir returns the directory holding user themes, one per file,
+// named after the file: themes/solarized.toml is the "solarized" theme.
+func themesDir() string {
+	return filepath.Join(configDir(), "themes")
+}
+
+// loadThemes reads the user themes over the built-in ones. Missing colors
+// are taken from the auto theme.
+func loadThemes(dir string) (map[string]theme, error) {
+	all := make(map[string]theme, len(builtinThemes))
+	for name, t := range builtinThemes {
+		all[name] = t
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return all, err
+	}
+	for _, file := range files {
+		t := builtinThemes["auto"]
+		md, err := toml.DecodeFile(file, &t)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return all, fmt.Errorf("theme %s: %w", file, err)
+		}
+		for _, key := range md.Undecoded() {
+			// the light and dark keys of a color table are read by
+			// themeColor itself
+			if len(key) == 1 {
+				return all, fmt.Errorf("theme %s: unknown key %s", file, key)
+			}
+		}
+		all[strings.TrimSuffix(filepath.Base(file), ".toml")] = t
+	}
+	return all, nil
+}
+
+// themeNames returns the built-in themes first, then the user themes.
+func themeNames() []string {
+	var user []string
+	for name := range themes {
+		if _, ok := builtinThemes[name]; !ok {
+			user = append(user, name)
+		}
+	}
+	sort.Strings(user)
+	return append(append([]string{}, builtinThemeOrder...), user...)
+}
+
+func nextThemeName(current string) string {
+	names := themeNames()
+	for i, name := range names {
+		if name == current {
+			return names[(i+1)%len(names)]
+		}
+	}
+	return names[0]
+}
+
+// applyTheme sets the package styles from the theme.
+func applyTheme(t theme) {
+	titleStyle = lipgloss.NewStyle().MarginLeft(2).Foreground(t.Accent.color()).Bold(true)
+	itemStyle = lipgloss.NewStyle().PaddingLeft(4).Foreground(t.Item.color())
+	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(t.Selected.color()).Background(t.SelectedBackground.color())
+	paginationStyle = list.DefaultStyles().PaginationStyle.PaddingLeft(4).Foreground(t.Muted.color())
+	helpStyle = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1).Foreground(t.Muted.color())
+	titleStyleViewport = func() lipgloss.Style {
+		b := lipgloss.RoundedBorder()
+		b.Right = "├"
+		return lipgloss.NewStyle().BorderStyle(b).BorderForeground(t.Accent.color()).Padding(0, 1)
+	}()
+	infoStyle = func() lipgloss.Style {
+		b := lipgloss.RoundedBorder()
+		b.Left = "┤"
+		return lipgloss.NewStyle().MarginLeft(2).BorderStyle(b).BorderForeground(t.Accent.color())
+	}()
+	bodyStyle = lipgloss.NewStyle().Foreground(t.Text.color()).Background(t.TextBackground.color())
+	textStyle = lipgloss.NewStyle().Foreground(t.Text.color()).Render
+	mutedStyle = lipgloss.NewStyle().Foreground(t.Muted.color())
+	spinnerStyle = lipgloss.NewStyle().Foreground(t.Accent.color())
+	helpBoxStyle = lipgloss.NewStyle().BorderStyle(lipgloss.RoundedBorder()).BorderForeground(t.Accent.color()).Padding(1, 2)
+	previewBoxStyle = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, false, false, true).BorderForeground(t.Muted.color()).PaddingLeft(1)
+	highlightStyle = lipgloss.NewStyle().Foreground(t.Highlight.color()).Background(t.HighlightBackground.color())
+	matchStyle = lipgloss.NewStyle().Foreground(t.Match.color()).Background(t.MatchBackground.color())
+	errorStyle = lipgloss.NewStyle().Foreground(t.Error.color()).Background(t.ErrorBackground.color()).Padding(0, 1)
+	tabStyle = lipgloss.NewStyle().Foreground(t.Muted.color()).Padding(0, 1)
+	insertedStyle = lipgloss.NewStyle().Foreground(t.Inserted.color()).Bold(true)
+	deletedStyle = lipgloss.NewStyle().Foreground(t.Deleted.color()).Strikethrough(true)
+	activeTabStyle = lipgloss.NewStyle().Foreground(t.Selected.color()).Background(t.SelectedBackground.color()).Padding(0, 1)
+}
+
+// setTheme applies the named theme and restyles the components of the
+// model that copied the package styles.
+func (m *model) setTheme(name string) {
+	m.Theme = name
+	applyTheme(themes[name])
+	m.List.Styles.Title = titleStyle
+	m.List.Styles.PaginationStyle = paginationStyle
+	m.List.Styles.HelpStyle = helpStyle
+	m.Library.Styles.Title = titleStyle
+	m.Library.Styles.PaginationStyle = paginationStyle
+	m.Library.Styles.HelpStyle = helpStyle
+	m.SearchResults.Styles.PaginationStyle = paginationStyle
+	m.spinner.Style = spinnerStyle
+	m.Viewport.Style = bodyStyle
+	m.Help.Styles.ShortKey = mutedStyle.Copy().Bold(true)
+	m.Help.Styles.ShortDesc = mutedStyle
+	m.Help.Styles.ShortSeparator = mutedStyle
+	m.Help.Styles.FullKey = mutedStyle.Copy().Bold(true)
+	m.Help.Styles.FullDesc = mutedStyle
+	m.Help.Styles.FullSeparator = mutedStyle
+	m.Help.Styles.Ellipsis = mutedStyle
+}
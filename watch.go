@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The open documents and the directory of the browser are polled for
+// changes. A rewritten document is read again once it stops changing, so
+// that a PDF still being written by LaTeX is never shown half done.
+
+// how often the files are checked for changes
+const watchInterval = time.Second
+
+// how long the reloaded notice stays in the footer
+const noticeDuration = 2 * time.Second
+
+// fileStamp tells a rewritten file from the one that was read.
+type fileStamp struct {
+	Size    int64
+	ModTime int64
+}
+
+func statStamp(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+type watchTickMsg struct{}
+
+func watchCmd() tea.Cmd {
+	return tea.Tick(watchInterval, func(time.Time) tea.Msg {
+		return watchTickMsg{}
+	})
+}
+
+// noticeDoneMsg clears the notice shown with the same Seq.
+type noticeDoneMsg struct {
+	Seq int
+}
+
+func (m model) handleWatchTickMsg() (tea.Model, tea.Cmd) {
+	if m.PasswordMode {
+		return m, watchCmd()
+	}
+	cmds := []tea.Cmd{watchCmd()}
+	if msg, ok := m.checkDocument(); ok {
+		cmds = append(cmds, func() tea.Msg { return msg })
+	}
+	if m.Split {
+		m.swapPanes()
+		msg, ok := m.checkDocument()
+		m.swapPanes()
+		if ok {
+			// the other pane is read in place, as when the split is opened
+			next, cmd := m.inOtherPane(func(m model) (tea.Model, tea.Cmd) {
+				return m.handleLoadContentMsg(msg)
+			})
+			m = next.(model)
+			cmds = append(cmds, cmd)
+		}
+	}
+	cmds = append(cmds, m.checkDir())
+	return m, tea.Batch(cmds...)
+}
+
+// checkDocument looks for a new version of the document. A change is only
+// acted on once the file has kept the same size and time for a whole
+// interval and opens as a PDF; until then the old text stays. It returns
+// the message that reads the visible page again, at the same scroll.
+func (m *model) checkDocument() (LoadContentMsg, bool) {
+	if m.FileName == "" || m.Stamp == (fileStamp{}) {
+		return LoadContentMsg{}, false
+	}
+	stamp, err := statStamp(m.FileName)
+	// a removed file may come back, the text read keeps being shown
+	if err != nil || stamp == m.Stamp {
+		m.pending = fileStamp{}
+		return LoadContentMsg{}, false
+	}
+	if stamp != m.pending {
+		m.pending = stamp
+		return LoadContentMsg{}, false
+	}
+	_, pages := readFileMeta(m.FileName)
+	if pages == 0 {
+		// not a whole PDF yet, try again on the next tick
+		return LoadContentMsg{}, false
+	}
+	m.pending = fileStamp{}
+	// not read again before the reload is done
+	m.Stamp = stamp
+	page := min(m.visiblePage(), pages)
+	return LoadContentMsg{FileName: m.FileName, Page: page, Offset: m.pageOffset(), Reload: true}, true
+}
+
+// checkDir reads the directory of the browser again when files were added
+// or removed, unless the list is being filtered.
+func (m *model) checkDir() tea.Cmd {
+	info, err := os.Stat(m.Dir)
+	if err != nil || info.ModTime().Equal(m.DirModTime) || m.List.FilterState() != list.Unfiltered {
+		return nil
+	}
+	cmd, err := m.reload()
+	if err != nil {
+		return nil
+	}
+	return cmd
+}
+
+// showNotice shows a short message in the footer of the document for a
+// couple of seconds.
+func (m *model) showNotice(text string) tea.Cmd {
+	m.noticeSeq++
+	m.Notice = text
+	seq := m.noticeSeq
+	return tea.Tick(noticeDuration, func(time.Time) tea.Msg {
+		return noticeDoneMsg{Seq: seq}
+	})
+}
+
+func (m model) handleNoticeDoneMsg(msg noticeDoneMsg) (tea.Model, tea.Cmd) {
+	if msg.Seq != m.noticeSeq {
+		return m, nil
+	}
+	m.Notice = ""
+	m.SplitDoc.Notice = ""
+	for i := range m.Tabs {
+		m.Tabs[i].Notice = ""
+	}
+	return m, nil
+}